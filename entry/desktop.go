@@ -8,22 +8,103 @@
 package entry
 
 import (
+	"flag"
 	"fmt"
 	"log"
 
 	"github.com/andreas-jonsson/voxbox/game"
 	"github.com/andreas-jonsson/voxbox/game/menu"
 	"github.com/andreas-jonsson/voxbox/game/play"
+	"github.com/andreas-jonsson/voxbox/game/replay"
 	"github.com/andreas-jonsson/voxbox/platform"
+	"github.com/andreas-jonsson/voxel/voxel"
 )
 
+// Files to record the session to or replay it from.
+var recordFile, replayFile string
+
+// parseFlags returns a copy of settings with the command line flags applied.
+// The copy is only used for this session, the settings written back by the
+// game are not affected by the flags.
+func parseFlags(settings *game.Settings) *game.Settings {
+	cfg := settings.Clone()
+
+	flag.IntVar(&cfg.WindowWidth, "width", cfg.WindowWidth, "window width, 0 uses the desktop width")
+	flag.IntVar(&cfg.WindowHeight, "height", cfg.WindowHeight, "window height, 0 uses the desktop height")
+	flag.IntVar(&cfg.ResolutionDiv, "div", cfg.ResolutionDiv, "resolution divisor")
+	flag.BoolVar(&cfg.Fullscreen, "fullscreen", cfg.Fullscreen, "fullscreen mode")
+	flag.BoolVar(&cfg.VSync, "vsync", cfg.VSync, "vertical sync")
+	flag.BoolVar(&cfg.Debug, "debug", cfg.Debug, "check for GL errors every frame")
+	flag.Var(&cfg.RoomSize, "room", "room size as WxHxD")
+	flag.IntVar(&cfg.TickRate, "tickrate", cfg.TickRate, "simulation updates per second")
+	flag.StringVar(&cfg.Level, "level", cfg.Level, "start the game in this level")
+	var deadZone float64
+	flag.Float64Var(&deadZone, "deadzone", float64(cfg.DeadZone), "gamepad dead zone, 0 to 1")
+	flag.StringVar(&recordFile, "record", "", "record input and room edits to this file")
+	flag.StringVar(&replayFile, "replay", "", "replay a recording, with the settings it was recorded with")
+	flag.Parse()
+
+	if recordFile != "" && replayFile != "" {
+		log.Panicln("can not record and replay at the same time")
+	}
+
+	if cfg.ResolutionDiv <= 0 || cfg.TickRate <= 0 {
+		log.Panicln("resolution divisor and tick rate must be positive")
+	}
+	if deadZone < 0 || deadZone >= 1 {
+		log.Panicln("dead zone must be in the range 0 to 1")
+	}
+	cfg.DeadZone = float32(deadZone)
+	return cfg
+}
+
 func Entry() {
 	if err := platform.Init(); err != nil {
 		log.Panicln(err)
 	}
 	defer platform.Shutdown()
 
-	rnd, err := platform.NewRenderer(platform.ConfigWithDiv(2), platform.ConfigWithNoVSync) //, platform.ConfigWithDebug)
+	settings, err := game.LoadSettings(platform.CfgRootJoin(game.SettingsFile))
+	if err != nil {
+		log.Println("Could not load settings:", err)
+	}
+	cfg := parseFlags(settings)
+
+	var source game.EventSource = platform.NewEventSource(cfg.DeadZone)
+	if replayFile != "" {
+		p, err := replay.Open(replayFile, source)
+		if err != nil {
+			log.Panicln(err)
+		}
+
+		// The recorded settings are used by the game too, so the input is
+		// bound to the same actions.
+		cfg = p.Settings()
+		settings = p.Settings()
+		source = p
+	} else if recordFile != "" {
+		r, err := replay.NewRecorder(recordFile, source, cfg)
+		if err != nil {
+			log.Panicln(err)
+		}
+		source = r
+	}
+
+	configs := []platform.Config{
+		platform.ConfigWithSize(cfg.WindowWidth, cfg.WindowHeight),
+		platform.ConfigWithDiv(cfg.ResolutionDiv),
+	}
+	if !cfg.VSync {
+		configs = append(configs, platform.ConfigWithNoVSync)
+	}
+	if cfg.Fullscreen {
+		configs = append(configs, platform.ConfigWithFulscreen)
+	}
+	if cfg.Debug {
+		configs = append(configs, platform.ConfigWithDebug)
+	}
+
+	rnd, err := platform.NewRenderer(configs...)
 	if err != nil {
 		log.Panicln(err)
 	}
@@ -31,19 +112,31 @@ func Entry() {
 
 	platform.LogGLInfo()
 
+	playState, err := play.NewPlayState(play.ConfigWithRoomSize(voxel.Pt(cfg.RoomSize[0], cfg.RoomSize[1], cfg.RoomSize[2])))
+	if err != nil {
+		log.Panicln(err)
+	}
+
 	states := map[string]game.GameState{
 		"menu": menu.NewMenuState(),
-		"play": play.NewPlayState(),
+		"play": playState,
 	}
 
-	g, err := game.NewGame(states)
+	g, err := game.NewGame(rnd, settings, states, source)
 	if err != nil {
 		log.Panicln(err)
 	}
 	defer g.Shutdown()
 
+	g.SetTickRate(cfg.TickRate)
+
 	var gctl game.GameControl = g
-	if err := g.SwitchState("menu", gctl); err != nil {
+	if cfg.Level != "" {
+		err = g.SwitchState("play", gctl, cfg.Level)
+	} else {
+		err = g.SwitchState("menu", gctl)
+	}
+	if err != nil {
 		log.Panicln(err)
 	}
 
@@ -14,6 +14,8 @@ import (
 	"github.com/andreas-jonsson/voxbox/game/menu"
 	"github.com/andreas-jonsson/voxbox/game/play"
 	"github.com/andreas-jonsson/voxbox/platform"
+	"github.com/andreas-jonsson/voxbox/platform/display"
+	"github.com/andreas-jonsson/voxel/voxel"
 
 	"golang.org/x/mobile/app"
 	"golang.org/x/mobile/event/key"
@@ -25,7 +27,7 @@ import (
 )
 
 var (
-	renderer     platform.Renderer
+	renderer     display.Renderer
 	gameInstance game.Game
 )
 
@@ -39,15 +41,26 @@ func initialize() {
 		log.Panicln(err)
 	}
 
+	settings, err := game.LoadSettings(platform.CfgRootJoin(game.SettingsFile))
+	if err != nil {
+		log.Println("Could not load settings:", err)
+	}
+
+	playState, err := play.NewPlayState(play.ConfigWithRoomSize(voxel.Pt(settings.RoomSize[0], settings.RoomSize[1], settings.RoomSize[2])))
+	if err != nil {
+		log.Panicln(err)
+	}
+
 	states := map[string]game.GameState{
 		"menu": menu.NewMenuState(),
-		"play": play.NewPlayState(),
+		"play": playState,
 	}
 
-	gameInstance, err = game.NewGame(states)
+	gameInstance, err = game.NewGame(renderer, settings, states, platform.NewEventSource(settings.DeadZone))
 	if err != nil {
 		log.Panicln(err)
 	}
+	gameInstance.SetTickRate(settings.TickRate)
 
 	var gctl game.GameControl = g
 	if err := g.SwitchState("menu", gctl); err != nil {
@@ -0,0 +1,291 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package debug
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"time"
+
+	"github.com/andreas-jonsson/voxbox/text"
+	"github.com/goxjs/gl"
+	"github.com/goxjs/gl/glutil"
+)
+
+const (
+	overlayWidth  = 256
+	overlayHeight = 192
+	overlayScale  = 2
+
+	historySize = 128
+	graphHeight = 48
+
+	// graphRange is the frame time at the top of the graph.
+	graphRange = 33 * time.Millisecond
+)
+
+var (
+	backgroundColor = color.RGBA{0, 0, 0, 160}
+	textColor       = color.RGBA{255, 255, 255, 255}
+	markerColor     = color.RGBA{255, 255, 255, 96}
+
+	sectionColors = []color.RGBA{
+		{255, 96, 96, 255},
+		{96, 255, 96, 255},
+		{96, 160, 255, 255},
+		{255, 255, 96, 255},
+		{255, 96, 255, 255},
+	}
+)
+
+type section struct {
+	name    string
+	history [historySize]time.Duration
+}
+
+// Overlay draws text and a frame time graph on top of the screen. Sections
+// are measured every frame and drawn stacked in the graph.
+type Overlay struct {
+	visible  bool
+	img      *image.RGBA
+	lines    []string
+	sections []*section
+	frame    int
+
+	// created is set once the font and GL resources are created, which
+	// is done the first time the overlay is shown.
+	created bool
+	font    *text.Font
+	batch   *text.Batch
+
+	textureID      gl.Texture
+	quadID         gl.Buffer
+	programID      gl.Program
+	positionAttrib gl.Attrib
+	rectUniform,
+	textureSampler gl.Uniform
+}
+
+// NewOverlay returns a hidden overlay. It needs no GL context until it is
+// shown, so states can measure and update it without one.
+func NewOverlay() *Overlay {
+	return &Overlay{img: image.NewRGBA(image.Rect(0, 0, overlayWidth, overlayHeight))}
+}
+
+func (o *Overlay) create() error {
+	var err error
+	if o.font, err = text.LoadFont(text.DefaultFont); err != nil {
+		return err
+	}
+	if o.batch, err = text.NewBatch(o.font); err != nil {
+		o.font.Destroy()
+		return err
+	}
+
+	o.programID, err = glutil.CreateProgram(overlayVertexShaderSrc, overlayFragmentShaderSrc)
+	if err != nil {
+		o.batch.Destroy()
+		o.font.Destroy()
+		return err
+	}
+
+	o.positionAttrib = gl.GetAttribLocation(o.programID, "a_position")
+	o.rectUniform = gl.GetUniformLocation(o.programID, "u_rect")
+	o.textureSampler = gl.GetUniformLocation(o.programID, "u_texture")
+
+	o.textureID = gl.CreateTexture()
+	gl.BindTexture(gl.TEXTURE_2D, o.textureID)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+
+	o.quadID = gl.CreateBuffer()
+	gl.BindBuffer(gl.ARRAY_BUFFER, o.quadID)
+	gl.BufferData(gl.ARRAY_BUFFER, []byte{0xFF, 0xFF, 1, 0xFF, 0xFF, 1, 1, 1}, gl.STATIC_DRAW)
+
+	o.created = true
+	return nil
+}
+
+func (o *Overlay) Destroy() {
+	if !o.created {
+		return
+	}
+	o.created = false
+
+	o.batch.Destroy()
+	o.font.Destroy()
+	gl.DeleteProgram(o.programID)
+	gl.DeleteTexture(o.textureID)
+	gl.DeleteBuffer(o.quadID)
+}
+
+func (o *Overlay) Toggle() {
+	o.visible = !o.visible
+}
+
+func (o *Overlay) Visible() bool {
+	return o.visible
+}
+
+// Measure records the time since start in the named section of the current frame.
+func (o *Overlay) Measure(name string, start time.Time) {
+	d := time.Since(start)
+	for _, s := range o.sections {
+		if s.name == name {
+			s.history[o.frame] += d
+			return
+		}
+	}
+
+	s := &section{name: name}
+	s.history[o.frame] = d
+	o.sections = append(o.sections, s)
+}
+
+// Printf adds a line of text to the current frame.
+func (o *Overlay) Printf(format string, args ...interface{}) {
+	o.lines = append(o.lines, fmt.Sprintf(format, args...))
+}
+
+// Render draws the overlay, if visible, and starts a new frame.
+func (o *Overlay) Render() {
+	if o.visible && !o.created {
+		if err := o.create(); err != nil {
+			log.Println("Could not create debug overlay:", err)
+			o.visible = false
+		}
+	}
+
+	if o.visible {
+		o.draw()
+		o.present()
+	}
+
+	o.lines = o.lines[:0]
+	o.frame = (o.frame + 1) % historySize
+	for _, s := range o.sections {
+		s.history[o.frame] = 0
+	}
+}
+
+func (o *Overlay) draw() {
+	img := o.img
+	for i := 0; i < len(img.Pix); i += 4 {
+		copy(img.Pix[i:i+4], []byte{backgroundColor.R, backgroundColor.G, backgroundColor.B, backgroundColor.A})
+	}
+
+	lineHeight := o.font.CharSize().Y * overlayScale
+	y := 2 * overlayScale
+	for i, s := range o.sections {
+		var avg time.Duration
+		for _, d := range s.history {
+			avg += d
+		}
+		avg /= historySize
+
+		c := sectionColors[i%len(sectionColors)]
+		o.batch.Printf(2*overlayScale, y, overlayScale, c, "%s %.2fms", s.name, avg.Seconds()*1000)
+		y += lineHeight
+	}
+
+	for _, l := range o.lines {
+		o.batch.Draw(2*overlayScale, y, overlayScale, textColor, l)
+		y += lineHeight
+	}
+
+	o.drawGraph()
+}
+
+// drawGraph draws the section history, oldest frame to the left.
+func (o *Overlay) drawGraph() {
+	img := o.img
+	bottom := overlayHeight - 2
+	left := (overlayWidth - historySize) / 2
+
+	for _, ms := range []time.Duration{16667 * time.Microsecond, graphRange} {
+		y := bottom - int(ms*graphHeight/graphRange)
+		for x := left; x < left+historySize; x++ {
+			img.SetRGBA(x, y, markerColor)
+		}
+	}
+
+	for i := 0; i < historySize; i++ {
+		frame := (o.frame + 1 + i) % historySize
+		y := bottom
+
+		for j, s := range o.sections {
+			h := int(s.history[frame] * graphHeight / graphRange)
+			c := sectionColors[j%len(sectionColors)]
+			for ; h > 0 && y > bottom-graphHeight; h-- {
+				img.SetRGBA(left+i, y, c)
+				y--
+			}
+		}
+	}
+}
+
+func (o *Overlay) present() {
+	var viewport [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, viewport[:])
+	w, h := float32(viewport[2]), float32(viewport[3])
+
+	gl.Disable(gl.DEPTH_TEST)
+	gl.Disable(gl.CULL_FACE)
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+
+	gl.UseProgram(o.programID)
+	gl.Uniform1i(o.textureSampler, 0)
+	gl.Uniform4f(o.rectUniform, -1, 1-2*overlayHeight*overlayScale/h, -1+2*overlayWidth*overlayScale/w, 1)
+
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, o.textureID)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, overlayWidth, overlayHeight, gl.RGBA, gl.UNSIGNED_BYTE, o.img.Pix)
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, o.quadID)
+	gl.VertexAttribPointer(o.positionAttrib, 2, gl.BYTE, false, 0, 0)
+	gl.EnableVertexAttribArray(o.positionAttrib)
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+
+	gl.Disable(gl.BLEND)
+	gl.Enable(gl.DEPTH_TEST)
+
+	o.batch.Flush()
+}
+
+var overlayVertexShaderSrc = `
+	#version 120
+
+	uniform vec4 u_rect;
+
+	attribute vec2 a_position;
+
+	varying vec2 v_uv;
+
+	void main()
+	{
+		vec2 t = a_position * 0.5 + 0.5;
+		v_uv = vec2(t.x, 1.0 - t.y);
+		gl_Position = vec4(mix(u_rect.xy, u_rect.zw, t), 0.0, 1.0);
+	}
+`
+
+var overlayFragmentShaderSrc = `
+	#version 120
+
+	uniform sampler2D u_texture;
+
+	varying vec2 v_uv;
+
+	void main()
+	{
+		gl_FragColor = texture2D(u_texture, v_uv);
+	}
+`
@@ -0,0 +1,110 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+// Package entity holds the game objects that move around in the room.
+// An entity is made of optional components and is updated by a World on
+// the game tick.
+package entity
+
+import (
+	"math"
+	"time"
+
+	"github.com/andreas-jonsson/voxbox/room"
+	"github.com/andreas-jonsson/voxbox/sprite"
+	"github.com/andreas-jonsson/voxbox/view"
+	"github.com/andreas-jonsson/voxel/voxel"
+	"github.com/ungerik/go3d/vec3"
+)
+
+// Animation played when an entity dies, before it is left in the room.
+const AnimDie = "die"
+
+type ID uint32
+
+// Transform places an entity in the room. Pos is the minimum corner of the
+// entity and Facing the number of quarter turns around the vertical axis.
+type Transform struct {
+	Pos, LastPos vec3.T
+	Facing       int
+}
+
+// Position returns the position interpolated between the last two updates.
+func (t *Transform) Position(alpha float32) vec3.T {
+	return vec3.Interpolate(&t.LastPos, &t.Pos, alpha)
+}
+
+// Face turns the transform towards the direction x, z.
+func (t *Transform) Face(x, z float32) {
+	if x != 0 || z != 0 {
+		a := math.Atan2(float64(x), float64(z))
+		t.Facing = (int(math.Floor(a/(math.Pi/2)+0.5)) + 4) % 4
+	}
+}
+
+// Model is an animated sprite rendered with a row of the view palette.
+type Model struct {
+	*sprite.Animator
+	PaletteRow uint8
+}
+
+func NewModel(s *sprite.Sprite, row uint8) *Model {
+	return &Model{Animator: sprite.NewAnimator(s), PaletteRow: row}
+}
+
+// Render draws the current frame to the view, which shows the room from
+// origin.
+func (m *Model) Render(v *view.View, t *Transform, origin voxel.Point, alpha float32) {
+	pos := t.Position(alpha)
+	at := collisionBox(pos, voxel.ZP).Min.Sub(origin)
+
+	row := v.PaletteRow()
+	v.SetPaletteRow(m.PaletteRow)
+	m.Blit(v, at, t.Facing)
+	v.SetPaletteRow(row)
+}
+
+// Bake leaves the current frame in the room as voxels, reported as a die
+// edit with name as argument.
+func (m *Model) Bake(r room.Interface, t *Transform, name string) {
+	at := collisionBox(t.Pos, voxel.ZP).Min
+	s, frame, facing := m.Sprite(), m.Frame(), t.Facing
+
+	// 	Do not wait for result.
+	r.Apply(room.Edit{Op: "die", At: at, Arg: name}, func(r *room.Room) {
+		s.Blit(r, at, frame, facing)
+	})
+}
+
+// Health kills the entity when HP reaches zero.
+type Health struct {
+	HP, Max int
+}
+
+// Script is called every update before the physics.
+type Script func(w *World, e *Entity, dt time.Duration)
+
+// Entity is a game object, all components but the transform are optional.
+type Entity struct {
+	id   ID
+	Name string
+
+	Transform Transform
+	Model     *Model
+	Body      *Body
+	Script    Script
+	Health    *Health
+
+	dying, dead bool
+}
+
+func (e *Entity) ID() ID {
+	return e.id
+}
+
+// Alive returns false once the entity has been killed.
+func (e *Entity) Alive() bool {
+	return !e.dying && !e.dead
+}
@@ -0,0 +1,121 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package entity
+
+import (
+	"math"
+	"time"
+
+	"github.com/andreas-jonsson/voxel/voxel"
+	"github.com/ungerik/go3d/vec3"
+)
+
+// Acceleration and speed in voxels per second.
+const (
+	DefaultGravity = 120
+	maxFallSpeed   = 100
+)
+
+// Body is a box that collides with the room. Walking into a single voxel
+// high obstacle while on the ground steps up on it.
+type Body struct {
+	Size     voxel.Point
+	Vel      vec3.T
+	Gravity  float32
+	OnGround bool
+
+	// Blocked is set if the last horizontal movement was blocked.
+	Blocked bool
+}
+
+// Bounds returns the voxels covered by the body.
+func (b *Body) Bounds(t *Transform) voxel.Box {
+	return collisionBox(t.Pos, b.Size)
+}
+
+// Collider is what bodies collide with, a room.Region or the room itself
+// from the room goroutine.
+type Collider interface {
+	Collides(box voxel.Box) bool
+}
+
+// Step applies gravity and moves the body by its velocity.
+func (b *Body) Step(t *Transform, c Collider, dt time.Duration) {
+	s := float32(dt.Seconds())
+
+	b.Vel[1] -= b.Gravity * s
+	if b.Vel[1] < -maxFallSpeed {
+		b.Vel[1] = -maxFallSpeed
+	}
+
+	below := t.Pos
+	below[1] -= 0.01
+	b.OnGround = c.Collides(collisionBox(below, b.Size))
+
+	b.Blocked = b.move(t, c, 0, b.Vel[0]*s)
+	b.Blocked = b.move(t, c, 2, b.Vel[2]*s) || b.Blocked
+	if b.move(t, c, 1, b.Vel[1]*s) {
+		if b.Vel[1] < 0 {
+			b.OnGround = true
+		}
+		b.Vel[1] = 0
+	}
+}
+
+// move moves the body d voxels along axis in steps of at most one voxel.
+// It returns true if the movement was blocked.
+func (b *Body) move(t *Transform, c Collider, axis int, d float32) bool {
+	steps := int(math.Ceil(math.Abs(float64(d))))
+	for i := 0; i < steps; i++ {
+		step := d / float32(steps)
+		pos := t.Pos
+		pos[axis] += step
+
+		if !c.Collides(collisionBox(pos, b.Size)) {
+			t.Pos = pos
+			continue
+		}
+
+		if axis != 1 && b.OnGround {
+			up := pos
+			up[1] = float32(math.Floor(float64(up[1]))) + 1
+			if !c.Collides(collisionBox(up, b.Size)) {
+				t.Pos = up
+				continue
+			}
+		}
+
+		// Move up against the obstacle.
+		if step > 0 {
+			pos[axis] = float32(math.Floor(float64(pos[axis])))
+		} else {
+			pos[axis] = float32(math.Ceil(float64(pos[axis])))
+		}
+		if (pos[axis]-t.Pos[axis])*step > 0 && !c.Collides(collisionBox(pos, b.Size)) {
+			t.Pos = pos
+		}
+		return true
+	}
+	return false
+}
+
+// collisionBox returns the voxels covered by a box of size at pos.
+func collisionBox(pos vec3.T, size voxel.Point) voxel.Box {
+	floor := func(v float32) int { return int(math.Floor(float64(v))) }
+	ceil := func(v float32) int { return int(math.Ceil(float64(v))) }
+
+	return voxel.Box{
+		Min: voxel.Pt(floor(pos[0]), floor(pos[1]), floor(pos[2])),
+		Max: voxel.Pt(ceil(pos[0]+float32(size.X)), ceil(pos[1]+float32(size.Y)), ceil(pos[2]+float32(size.Z))),
+	}
+}
+
+// overlaps returns true if a and b share any voxel.
+func overlaps(a, b voxel.Box) bool {
+	return a.Min.X < b.Max.X && b.Min.X < a.Max.X &&
+		a.Min.Y < b.Max.Y && b.Min.Y < a.Max.Y &&
+		a.Min.Z < b.Max.Z && b.Min.Z < a.Max.Z
+}
@@ -0,0 +1,158 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package entity
+
+import (
+	"time"
+
+	"github.com/andreas-jonsson/voxbox/room"
+	"github.com/andreas-jonsson/voxbox/view"
+	"github.com/andreas-jonsson/voxel/voxel"
+)
+
+// World holds the entities in a room. Entities are updated in the order
+// they were spawned, to keep the game deterministic.
+type World struct {
+	room     room.Interface
+	entities []*Entity
+	nextID   ID
+}
+
+func NewWorld(r room.Interface) *World {
+	return &World{room: r, nextID: 1}
+}
+
+func (w *World) Room() room.Interface {
+	return w.room
+}
+
+// Spawn adds e to the world and returns its id.
+func (w *World) Spawn(e *Entity) ID {
+	e.id = w.nextID
+	w.nextID++
+
+	e.Transform.LastPos = e.Transform.Pos
+	w.entities = append(w.entities, e)
+	return e.id
+}
+
+// Entity returns the entity with id, or nil if it is gone.
+func (w *World) Entity(id ID) *Entity {
+	for _, e := range w.entities {
+		if e.id == id {
+			return e
+		}
+	}
+	return nil
+}
+
+func (w *World) Len() int {
+	return len(w.entities)
+}
+
+// Clear removes all entities without leaving them in the room.
+func (w *World) Clear() {
+	w.entities = w.entities[:0]
+}
+
+// Kill plays the die animation of e, if it has one, and then leaves its
+// model in the room.
+func (w *World) Kill(e *Entity) {
+	if !e.Alive() {
+		return
+	}
+
+	if e.Model != nil && e.Model.Play(AnimDie) {
+		e.dying = true
+	} else {
+		w.remove(e)
+	}
+}
+
+// Damage removes amount of health from the entities that overlap box.
+func (w *World) Damage(box voxel.Box, amount int) {
+	for _, e := range w.entities {
+		if e.Health == nil || e.Body == nil || !e.Alive() {
+			continue
+		}
+
+		if overlaps(box, e.Body.Bounds(&e.Transform)) {
+			if e.Health.HP -= amount; e.Health.HP <= 0 {
+				w.Kill(e)
+			}
+		}
+	}
+}
+
+// remove marks e as dead and leaves its model in the room.
+func (w *World) remove(e *Entity) {
+	e.dying, e.dead = false, true
+	if e.Model != nil {
+		e.Model.Bake(w.room, &e.Transform, e.Name)
+	}
+}
+
+// Update runs the scripts, physics and animations of all entities one
+// step. The bodies are stepped together in a single call to the room, after
+// the scripts. Dead entities are removed.
+func (w *World) Update(dt time.Duration) {
+	var bodies []*Entity
+	for i := 0; i < len(w.entities); i++ {
+		e := w.entities[i]
+		e.Transform.LastPos = e.Transform.Pos
+
+		if e.Model != nil {
+			e.Model.Update(dt)
+		}
+
+		if e.dying {
+			if e.Model.Done() {
+				w.remove(e)
+			}
+			continue
+		}
+
+		if e.Script != nil && !e.dead {
+			e.Script(w, e, dt)
+		}
+
+		if e.Body != nil {
+			bodies = append(bodies, e)
+		}
+	}
+
+	if len(bodies) > 0 {
+		<-w.room.Send(func(r *room.Room) {
+			for _, e := range bodies {
+				// Scripts may have killed entities after they were added.
+				if e.Alive() {
+					e.Body.Step(&e.Transform, r, dt)
+				}
+			}
+		})
+	}
+
+	alive := w.entities[:0]
+	for _, e := range w.entities {
+		if !e.dead {
+			alive = append(alive, e)
+		}
+	}
+	for i := len(alive); i < len(w.entities); i++ {
+		w.entities[i] = nil
+	}
+	w.entities = alive
+}
+
+// Render draws the models of the entities to the view, which shows the
+// room from origin.
+func (w *World) Render(v *view.View, origin voxel.Point, alpha float32) {
+	for _, e := range w.entities {
+		if e.Model != nil && !e.dead {
+			e.Model.Render(v, &e.Transform, origin, alpha)
+		}
+	}
+}
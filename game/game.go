@@ -6,11 +6,14 @@
 package game
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
-	"github.com/andreas-jonsson/voxbox/platform"
+	"github.com/andreas-jonsson/voxbox/platform/display"
+	"github.com/andreas-jonsson/voxbox/platform/input"
+	"github.com/andreas-jonsson/voxbox/room"
 )
 
 type (
@@ -19,34 +22,106 @@ type (
 		Enter(from GameState, args ...interface{}) error
 		Exit(to GameState) error
 		Update(gctl GameControl) error
-		Render() error
+		Render(alpha float32) error
+	}
+
+	// PostEffectState is implemented by states that use post processing.
+	// The effects are enabled when the state is entered, states that do
+	// not implement it are rendered without effects.
+	PostEffectState interface {
+		PostEffects() (display.PostEffects, display.PostSettings)
+	}
+
+	// OverlayState is implemented by states that draw on top of the post
+	// processed scene.
+	OverlayState interface {
+		RenderOverlay() error
+	}
+
+	// PausableState is notified when another state is pushed on top of it
+	// and when it is on top of the stack again.
+	PausableState interface {
+		Pause()
+		Resume()
+	}
+
+	// TransparentState is implemented by states that are rendered on top of
+	// the state beneath them on the stack.
+	TransparentState interface {
+		Transparent() bool
+	}
+
+	// MouseLookState is implemented by states that use relative mouse
+	// motion. The mouse is released when another state is on top.
+	MouseLookState interface {
+		MouseLook() bool
 	}
 
 	GameControl interface {
 		SwitchState(to string, args ...interface{}) error
+		PushState(to string, args ...interface{}) error
+		PopState() error
 		CurrentStateName() string
 		Timing() (time.Duration, time.Duration, int)
+		FrameTime() time.Duration
 		PollAll()
-		PollEvent() platform.Event
+		PollEvent() input.Event
+		RecordEdit(e room.Edit)
+		Settings() *Settings
+		Actions() *input.ActionMap
 		Terminate()
 	}
 )
 
-var startupTime = time.Now()
+const (
+	DefaultTickRate = 60
+
+	// maxCatchUpSteps limits the number of updates in a single frame, time
+	// beyond that is dropped and the game runs slower.
+	maxCatchUpSteps = 5
+)
 
 type Game struct {
-	currentState GameState
-	states       map[string]GameState
+	stack    []GameState
+	states   map[string]GameState
+	renderer display.Renderer
+	settings *Settings
+	actions  *input.ActionMap
+	source   EventSource
+
+	// pendingActions are returned by PollEvent after the event they were
+	// translated from.
+	pendingActions []*input.ActionEvent
 
 	t, ft     time.Time
 	fps       int
 	dt, tick  time.Duration
+	steps     uint64
+	frameTime time.Duration
 	numFrames int
 	running   bool
+
+	// accumulator holds the time not yet consumed by updates.
+	accumulator time.Duration
+}
+
+// NewGame creates a game that consumes the events of source. The source is
+// usually the platform, or a recording or script that replaces it.
+func NewGame(rnd display.Renderer, settings *Settings, states map[string]GameState, source EventSource) (*Game, error) {
+	if source == nil {
+		return nil, errors.New("no event source")
+	}
+
+	g := &Game{running: true, renderer: rnd, settings: settings, states: states, source: source, t: time.Now()}
+	g.actions = input.NewActionMap()
+	settings.ApplyBindings(g.actions)
+	g.SetTickRate(DefaultTickRate)
+	return g, nil
 }
 
-func NewGame(states map[string]GameState) (*Game, error) {
-	return &Game{running: true, states: states, t: time.Now()}, nil
+// SetTickRate sets the number of updates per second.
+func (g *Game) SetTickRate(rate int) {
+	g.dt = time.Second / time.Duration(rate)
 }
 
 func (g *Game) PollAll() {
@@ -54,22 +129,34 @@ func (g *Game) PollAll() {
 	}
 }
 
-func (g *Game) PollEvent() platform.Event {
+// PollEvent returns the next event. Key and controller events bound to
+// actions are followed by their action events, capture keys are handled
+// and not returned.
+func (g *Game) PollEvent() input.Event {
+	if len(g.pendingActions) > 0 {
+		ev := g.pendingActions[0]
+		g.pendingActions = g.pendingActions[1:]
+		return ev
+	}
+
 	for {
-		event := platform.PollEvent()
+		event := g.source.PollEvent(g.steps)
 		if event == nil {
 			return nil
 		}
 
-		switch t := event.(type) {
-		case *platform.QuitEvent:
-			g.running = false
-		case *platform.KeyDownEvent:
-			switch t.Key {
-			case platform.KeyEsc:
-				g.running = false
-				continue
+		if IsCaptureKey(event) {
+			if t, ok := event.(*input.KeyDownEvent); ok {
+				g.capture(t.Key)
 			}
+			continue
+		}
+
+		switch event.(type) {
+		case *input.QuitEvent:
+			g.running = false
+		case *input.KeyDownEvent, *input.KeyUpEvent, *input.ControllerButtonEvent, *input.ControllerAxisEvent, *input.ControllerDeviceEvent:
+			g.pendingActions = g.actions.Translate(event)
 			return event
 		default:
 			return event
@@ -77,54 +164,269 @@ func (g *Game) PollEvent() platform.Event {
 	}
 }
 
+// IsCaptureKey returns true for key events of the keys that take
+// screenshots and recordings of the window. They are handled by the game
+// and are not part of a recorded session.
+func IsCaptureKey(event input.Event) bool {
+	var key int
+	switch t := event.(type) {
+	case *input.KeyDownEvent:
+		key = t.Key
+	case *input.KeyUpEvent:
+		key = t.Key
+	default:
+		return false
+	}
+	return isCaptureKey(key)
+}
+
+func isCaptureKey(key int) bool {
+	return key == input.KeyF12 || key == input.KeyF9
+}
+
+// capture saves a screenshot or toggles the recording of the window.
+func (g *Game) capture(key int) {
+	if key == input.KeyF12 {
+		g.renderer.SaveScreenshot()
+	} else {
+		g.toggleRecording()
+	}
+}
+
+// RecordEdit reports a room edit to the event source, if it records or
+// replays the session.
+func (g *Game) RecordEdit(e room.Edit) {
+	if ss, ok := g.source.(SessionSource); ok {
+		ss.RecordEdit(g.steps, e)
+	}
+}
+
+func (g *Game) toggleRecording() {
+	if g.renderer.Recording() {
+		if file, err := g.renderer.StopRecording(); err != nil {
+			log.Println("Could not save recording:", err)
+		} else {
+			log.Println("Saved recording:", file)
+		}
+	} else if err := g.renderer.StartRecording(display.RecordGIF); err != nil {
+		log.Println("Could not start recording:", err)
+	}
+}
+
 func (g *Game) CurrentStateName() string {
-	return g.currentState.Name()
+	if len(g.stack) == 0 {
+		return ""
+	}
+	return g.top().Name()
 }
 
+func (g *Game) top() GameState {
+	if len(g.stack) == 0 {
+		return nil
+	}
+	return g.stack[len(g.stack)-1]
+}
+
+func (g *Game) state(name string) (GameState, error) {
+	s, ok := g.states[name]
+	if !ok {
+		return nil, fmt.Errorf("invalid state: %s", name)
+	}
+
+	for _, st := range g.stack {
+		if st == s {
+			return nil, fmt.Errorf("state is already on the stack: %s", name)
+		}
+	}
+	return s, nil
+}
+
+// SwitchState exits all states on the stack and enters the new state. If a
+// state can not be exited it is kept on the stack, with the states beneath
+// it, and resumed. The exited states can not be restored if the new state
+// can not be entered, the stack is left empty.
 func (g *Game) SwitchState(to string, args ...interface{}) error {
 	newState, ok := g.states[to]
 	if !ok {
 		return fmt.Errorf("invalid state: %s", to)
 	}
 
-	currentState := g.currentState
+	currentState := g.top()
 
-	if currentState != nil {
-		log.Printf("Exiting state: %v", currentState.Name())
-		if err := currentState.Exit(newState); err != nil {
+	for len(g.stack) > 0 {
+		st := g.top()
+		g.stack = g.stack[:len(g.stack)-1]
+
+		log.Printf("Exiting state: %v", st.Name())
+		if err := st.Exit(newState); err != nil {
+			g.stack = append(g.stack, st)
+			g.applyPostEffects()
+			g.applyMouseMode()
+			if ps, ok := st.(PausableState); ok && st != currentState {
+				ps.Resume()
+			}
 			return err
 		}
 	}
 
-	g.currentState = newState
+	g.stack = append(g.stack, newState)
+	g.applyPostEffects()
+	g.applyMouseMode()
 
 	log.Printf("Enter state: %v", to)
 	if err := newState.Enter(currentState, args...); err != nil {
+		g.stack = g.stack[:0]
+		g.applyPostEffects()
+		g.applyMouseMode()
+		return err
+	}
+
+	return nil
+}
+
+// PushState enters the new state on top of the current state, which keeps
+// its resources and is paused until the new state is popped. If the new
+// state can not be entered the current state is resumed.
+func (g *Game) PushState(to string, args ...interface{}) error {
+	newState, err := g.state(to)
+	if err != nil {
+		return err
+	}
+
+	currentState := g.top()
+	if ps, ok := currentState.(PausableState); ok {
+		ps.Pause()
+	}
+
+	g.stack = append(g.stack, newState)
+	g.applyPostEffects()
+	g.applyMouseMode()
+
+	log.Printf("Push state: %v", to)
+	if err := newState.Enter(currentState, args...); err != nil {
+		g.stack = g.stack[:len(g.stack)-1]
+		g.applyPostEffects()
+		g.applyMouseMode()
+		if ps, ok := currentState.(PausableState); ok {
+			ps.Resume()
+		}
+		return err
+	}
+	return nil
+}
+
+// PopState exits the current state and resumes the state beneath it. The
+// current state is kept on the stack if it can not be exited.
+func (g *Game) PopState() error {
+	if len(g.stack) < 2 {
+		return errors.New("no state to return to")
+	}
+
+	currentState := g.top()
+	g.stack = g.stack[:len(g.stack)-1]
+	newState := g.top()
+
+	log.Printf("Pop state: %v", currentState.Name())
+	if err := currentState.Exit(newState); err != nil {
+		g.stack = append(g.stack, currentState)
+		g.applyPostEffects()
+		g.applyMouseMode()
 		return err
 	}
 
+	g.applyPostEffects()
+	g.applyMouseMode()
+	if ps, ok := newState.(PausableState); ok {
+		ps.Resume()
+	}
 	return nil
 }
 
+// visibleStates returns the states that are rendered, the bottom one
+// first. Transparent states include the state beneath them.
+func (g *Game) visibleStates() []GameState {
+	if len(g.stack) == 0 {
+		return nil
+	}
+
+	i := len(g.stack) - 1
+	for ; i > 0; i-- {
+		if ts, ok := g.stack[i].(TransparentState); !ok || !ts.Transparent() {
+			break
+		}
+	}
+	return g.stack[i:]
+}
+
+// applyMouseMode enables relative mouse mode if the current state uses
+// mouse look.
+func (g *Game) applyMouseMode() {
+	ms, ok := g.top().(MouseLookState)
+	enabled := ok && ms.MouseLook()
+
+	if enabled {
+		g.renderer.SetMouseSensitivity(g.settings.MouseSensitivity, g.settings.InvertMouse)
+	}
+	if enabled != g.renderer.RelativeMouse() {
+		g.renderer.SetRelativeMouse(enabled)
+	}
+}
+
+// applyPostEffects enables the post effects of the bottom visible state.
+func (g *Game) applyPostEffects() {
+	if states := g.visibleStates(); len(states) > 0 {
+		if ps, ok := states[0].(PostEffectState); ok {
+			effects, settings := ps.PostEffects()
+			g.renderer.SetPostEffects(effects)
+			g.renderer.SetPostSettings(settings)
+			return
+		}
+	}
+	g.renderer.SetPostEffects(display.PostNone)
+}
+
 func (g *Game) Running() bool {
 	return g.running
 }
 
+// Timing returns the update step, the game time and the frame rate.
 func (g *Game) Timing() (time.Duration, time.Duration, int) {
 	return g.dt, g.tick, g.fps
 }
 
+// FrameTime returns the time between the two last frames.
+func (g *Game) FrameTime() time.Duration {
+	return g.frameTime
+}
+
+func (g *Game) Settings() *Settings {
+	return g.settings
+}
+
+func (g *Game) Actions() *input.ActionMap {
+	return g.actions
+}
+
 func (g *Game) Terminate() {
 	g.running = false
 }
 
 func (g *Game) Update() error {
-	g.dt = time.Since(g.t)
-	g.tick = time.Since(startupTime)
-	g.t = time.Now()
+	now := time.Now()
+	g.frameTime = now.Sub(g.t)
+	g.t = now
 
-	if err := g.currentState.Update(g); err != nil {
-		return err
+	g.accumulator += g.frameTime
+	for steps := 0; g.accumulator >= g.dt && g.running; steps++ {
+		if steps == maxCatchUpSteps {
+			g.accumulator %= g.dt
+			break
+		}
+
+		if err := g.Step(); err != nil {
+			return err
+		}
+		g.accumulator -= g.dt
 	}
 
 	g.numFrames++
@@ -137,12 +439,67 @@ func (g *Game) Update() error {
 	return nil
 }
 
-func (g *Game) Render() error {
-	if err := g.currentState.Render(); err != nil {
+// Step updates the current state once and advances the game time by one
+// update step, without regard to the time that has passed. Update calls it
+// as often as the elapsed time requires, tests call it directly.
+func (g *Game) Step() error {
+	if len(g.stack) == 0 {
+		return errors.New("no state to update")
+	}
+
+	if err := g.top().Update(g); err != nil {
 		return err
 	}
+
+	g.tick += g.dt
+	g.steps++
+	return nil
+}
+
+// Render draws the visible states from the bottom up. States above the
+// bottom one are drawn after post processing. Alpha is the fraction of the
+// next update that has passed, used to interpolate between updates.
+func (g *Game) Render() error {
+	alpha := float32(g.accumulator) / float32(g.dt)
+
+	for i, st := range g.visibleStates() {
+		if i > 0 {
+			g.renderer.PostProcess()
+		}
+
+		if err := st.Render(alpha); err != nil {
+			return err
+		}
+
+		if ovs, ok := st.(OverlayState); ok {
+			g.renderer.PostProcess()
+			if err := ovs.RenderOverlay(); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
 func (g *Game) Shutdown() {
+	if g.renderer.Recording() {
+		g.toggleRecording()
+	}
+
+	if ss, ok := g.source.(SessionSource); ok {
+		if err := ss.Finish(g.checksum()); err != nil {
+			log.Println("Could not finish session:", err)
+		}
+	}
+}
+
+// checksum returns the checksum of the bottom state on the stack that
+// implements ChecksumState. It returns false if there is no such state.
+func (g *Game) checksum() (uint32, bool) {
+	for _, st := range g.stack {
+		if cs, ok := st.(ChecksumState); ok {
+			return cs.Checksum(), true
+		}
+	}
+	return 0, false
 }
@@ -6,10 +6,77 @@
 package menu
 
 import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+
 	"github.com/andreas-jonsson/voxbox/game"
+	"github.com/andreas-jonsson/voxbox/game/play"
+	"github.com/andreas-jonsson/voxbox/platform/input"
+	"github.com/andreas-jonsson/voxbox/text"
+	"github.com/goxjs/gl"
+)
+
+const (
+	mainPage = iota
+	levelsPage
+	settingsPage
+	keysPage
+)
+
+// parentPage is the page Escape and Back returns to.
+var parentPage = map[int]int{
+	levelsPage:   mainPage,
+	settingsPage: mainPage,
+	keysPage:     settingsPage,
+}
+
+const (
+	maxResolutionDiv = 4
+
+	sensitivityStep = 0.25
+	maxSensitivity  = 4
 )
 
+// padNavigation maps gamepad buttons to the keys used to navigate the menu.
+var padNavigation = map[int]int{
+	input.ButtonDPadUp:    input.KeyUp,
+	input.ButtonDPadDown:  input.KeyDown,
+	input.ButtonDPadLeft:  input.KeyLeft,
+	input.ButtonDPadRight: input.KeyRight,
+	input.ButtonA:         input.KeyReturn,
+	input.ButtonB:         input.KeyEsc,
+	input.ButtonStart:     input.KeyEsc,
+}
+
+var (
+	titleColor    = color.RGBA{255, 255, 255, 255}
+	itemColor     = color.RGBA{160, 160, 160, 255}
+	selectedColor = color.RGBA{255, 200, 64, 255}
+	noteColor     = color.RGBA{96, 96, 96, 255}
+)
+
+type item struct {
+	label    string
+	value    func() string
+	activate func(gctl game.GameControl) error
+	change   func(dir int)
+}
+
 type menuState struct {
+	font  *text.Font
+	batch *text.Batch
+
+	page     int
+	title    string
+	note     string
+	items    []item
+	selected int
+
+	paused  bool
+	levels  []string
+	binding string
 }
 
 func NewMenuState() *menuState {
@@ -20,19 +87,351 @@ func (s *menuState) Name() string {
 	return "menu"
 }
 
+// Enter shows the main page. When pushed on top of play the menu is drawn
+// over the paused game and can resume it.
 func (s *menuState) Enter(from game.GameState, args ...interface{}) error {
-	return args[0].(game.GameControl).SwitchState("play", args[0])
+	var err error
+	if s.font, err = text.LoadFont(text.DefaultFont); err != nil {
+		return err
+	}
+	if s.batch, err = text.NewBatch(s.font); err != nil {
+		s.font.Destroy()
+		return err
+	}
+
+	if s.levels, err = play.Levels(); err != nil {
+		log.Println("Could not list levels:", err)
+	}
+
+	s.paused = from != nil && from.Name() == "play"
+	s.open(mainPage, args[0].(game.GameControl))
+	return nil
+}
+
+func (s *menuState) Transparent() bool {
+	return s.paused
 }
 
 func (s *menuState) Exit(to game.GameState) error {
+	s.batch.Destroy()
+	s.font.Destroy()
+	return nil
+}
+
+func (s *menuState) open(page int, gctl game.GameControl) {
+	settings := gctl.Settings()
+	s.page = page
+	s.selected = 0
+	s.note = ""
+	s.items = s.items[:0]
+
+	switch page {
+	case mainPage:
+		s.title = "VOXBOX"
+		if s.paused {
+			s.items = append(s.items, item{label: "Resume", activate: func(gctl game.GameControl) error {
+				return gctl.PopState()
+			}})
+		}
+		s.items = append(s.items,
+			item{label: "Levels", activate: s.openFunc(levelsPage)},
+			item{label: "Settings", activate: s.openFunc(settingsPage)},
+			item{label: "Quit", activate: func(gctl game.GameControl) error {
+				gctl.Terminate()
+				return nil
+			}},
+		)
+	case levelsPage:
+		s.title = "LEVELS"
+		for _, level := range s.levels {
+			level := level
+			s.items = append(s.items, item{label: level, activate: func(gctl game.GameControl) error {
+				return gctl.SwitchState("play", gctl, level)
+			}})
+		}
+		s.items = append(s.items, item{label: "Back", activate: s.back})
+	case settingsPage:
+		s.title = "SETTINGS"
+		s.note = "Display changes apply after restart"
+		s.items = append(s.items,
+			item{
+				label: "Resolution",
+				value: func() string { return fmt.Sprintf("1/%d", settings.ResolutionDiv) },
+				change: func(dir int) {
+					settings.ResolutionDiv = (settings.ResolutionDiv+dir+maxResolutionDiv-1)%maxResolutionDiv + 1
+				},
+			},
+			item{
+				label:  "VSync",
+				value:  func() string { return onOff(settings.VSync) },
+				change: func(int) { settings.VSync = !settings.VSync },
+			},
+			item{
+				label:  "Fullscreen",
+				value:  func() string { return onOff(settings.Fullscreen) },
+				change: func(int) { settings.Fullscreen = !settings.Fullscreen },
+			},
+			item{
+				label: "Mouse sensitivity",
+				value: func() string { return fmt.Sprintf("%.2f", settings.MouseSensitivity) },
+				change: func(dir int) {
+					v := settings.MouseSensitivity + float32(dir)*sensitivityStep
+					if v >= sensitivityStep && v <= maxSensitivity {
+						settings.MouseSensitivity = v
+					}
+				},
+			},
+			item{
+				label:  "Invert mouse",
+				value:  func() string { return onOff(settings.InvertMouse) },
+				change: func(int) { settings.InvertMouse = !settings.InvertMouse },
+			},
+			item{label: "Key bindings", activate: s.openFunc(keysPage)},
+			item{label: "Back", activate: s.back},
+		)
+	case keysPage:
+		s.title = "KEY BINDINGS"
+		s.note = "Escape or start cancels"
+		for _, action := range game.Actions {
+			action := action
+			s.items = append(s.items, item{
+				label: action,
+				value: func() string {
+					if s.binding == action {
+						return "..."
+					}
+					return fmt.Sprintf("%s / %s", bindingName(settings.Keys[action]), bindingName(settings.Buttons[action]))
+				},
+				activate: func(game.GameControl) error {
+					s.binding = action
+					return nil
+				},
+			})
+		}
+		s.items = append(s.items, item{label: "Back", activate: s.back})
+	}
+}
+
+func (s *menuState) openFunc(page int) func(gctl game.GameControl) error {
+	return func(gctl game.GameControl) error {
+		s.open(page, gctl)
+		return nil
+	}
+}
+
+// back returns to the parent page, settings are saved when leaving them.
+func (s *menuState) back(gctl game.GameControl) error {
+	switch s.page {
+	case mainPage:
+		if s.paused {
+			return gctl.PopState()
+		}
+		gctl.Terminate()
+		return nil
+	case settingsPage, keysPage:
+		if err := gctl.Settings().Save(); err != nil {
+			log.Println("Could not save settings:", err)
+		}
+	}
+
+	s.open(parentPage[s.page], gctl)
+	return nil
+}
+
+func (s *menuState) activate(gctl game.GameControl) error {
+	it := s.items[s.selected]
+	if it.activate != nil {
+		return it.activate(gctl)
+	}
+	if it.change != nil {
+		it.change(1)
+	}
 	return nil
 }
 
 func (s *menuState) Update(gctl game.GameControl) error {
-	gctl.PollAll()
+	for ev := gctl.PollEvent(); ev != nil; ev = gctl.PollEvent() {
+		if s.binding != "" {
+			s.bind(gctl, ev)
+			continue
+		}
+
+		switch t := ev.(type) {
+		case *input.KeyDownEvent:
+			if err := s.navigate(gctl, t.Key); err != nil {
+				return err
+			}
+		case *input.ControllerButtonEvent:
+			if key, ok := padNavigation[t.Button]; ok && t.Pressed {
+				if err := s.navigate(gctl, key); err != nil {
+					return err
+				}
+			}
+		case *input.MouseMotionEvent:
+			if i, ok := s.itemAt(t.X, t.Y); ok {
+				s.selected = i
+			}
+		case *input.MouseButtonEvent:
+			if t.Type != input.MouseButtonDown {
+				break
+			}
+			if i, ok := s.itemAt(t.X, t.Y); ok {
+				s.selected = i
+				return s.activate(gctl)
+			}
+		}
+
+		// The rest of the events belong to the state that replaced the menu.
+		if gctl.CurrentStateName() != s.Name() {
+			return nil
+		}
+	}
 	return nil
 }
 
-func (s *menuState) Render() error {
+// bind binds the next pressed key or gamepad button to the selected action.
+// Escape and the start button cancel, reserved keys are ignored.
+func (s *menuState) bind(gctl game.GameControl, ev input.Event) {
+	key := input.KeyUnknown
+	switch t := ev.(type) {
+	case *input.KeyDownEvent:
+		if t.Key != input.KeyEsc {
+			key = t.Key
+		}
+	case *input.ControllerButtonEvent:
+		if !t.Pressed {
+			return
+		}
+		if t.Button != input.ButtonStart {
+			key = input.PadA + t.Button
+		}
+	default:
+		return
+	}
+
+	if key != input.KeyUnknown {
+		settings := gctl.Settings()
+		if err := settings.Bind(s.binding, key); err != nil {
+			log.Println("Could not bind key:", err)
+			return
+		}
+		settings.ApplyBindings(gctl.Actions())
+	}
+	s.binding = ""
+}
+
+func (s *menuState) navigate(gctl game.GameControl, key int) error {
+	switch key {
+	case input.KeyUp:
+		s.selected = (s.selected + len(s.items) - 1) % len(s.items)
+	case input.KeyDown:
+		s.selected = (s.selected + 1) % len(s.items)
+	case input.KeyLeft, input.KeyRight:
+		if change := s.items[s.selected].change; change != nil {
+			if key == input.KeyLeft {
+				change(-1)
+			} else {
+				change(1)
+			}
+		}
+	case input.KeyReturn:
+		return s.activate(gctl)
+	case input.KeyEsc:
+		return s.back(gctl)
+	}
+	return nil
+}
+
+// layout returns the text scale and the top of the first item for the
+// current viewport.
+func (s *menuState) layout() (scale, top, width int) {
+	var viewport [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, viewport[:])
+
+	scale = int(viewport[3]) / 160
+	if scale < 1 {
+		scale = 1
+	}
+	return scale, int(viewport[3]) / 3, int(viewport[2])
+}
+
+func (s *menuState) itemText(i int) string {
+	it := &s.items[i]
+	if it.value != nil {
+		return fmt.Sprintf("%s: %s", it.label, it.value())
+	}
+	return it.label
+}
+
+func (s *menuState) itemRect(i int) image.Rectangle {
+	scale, top, width := s.layout()
+	size := s.font.Measure(s.itemText(i), scale)
+
+	// Long pages are packed tighter to fit the items and the note below
+	// the title, which takes the top third.
+	spacing := size.Y * 2
+	if fit := top * 2 / (len(s.items) + 2); fit < spacing {
+		spacing = fit
+		if spacing < size.Y {
+			spacing = size.Y
+		}
+	}
+
+	y := top + i*spacing
+	x := (width - size.X) / 2
+	return image.Rect(x, y, x+size.X, y+size.Y)
+}
+
+func (s *menuState) itemAt(x, y int) (int, bool) {
+	p := image.Pt(x, y)
+	for i := range s.items {
+		if p.In(s.itemRect(i).Inset(-4)) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (s *menuState) Render(alpha float32) error {
+	if !s.paused {
+		gl.ClearColor(0.1, 0.1, 0.12, 1)
+		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	}
+
+	scale, top, width := s.layout()
+
+	size := s.font.Measure(s.title, scale*2)
+	s.batch.DrawShadow((width-size.X)/2, top/2-size.Y/2, scale*2, titleColor, s.title)
+
+	for i := range s.items {
+		c := itemColor
+		if i == s.selected {
+			c = selectedColor
+		}
+		r := s.itemRect(i)
+		s.batch.DrawShadow(r.Min.X, r.Min.Y, scale, c, s.itemText(i))
+	}
+
+	if s.note != "" {
+		size := s.font.Measure(s.note, scale)
+		y := s.itemRect(len(s.items)-1).Max.Y + size.Y*2
+		s.batch.DrawShadow((width-size.X)/2, y, scale, noteColor, s.note)
+	}
+
+	s.batch.Flush()
 	return nil
 }
+
+func bindingName(name string) string {
+	if name == "" {
+		return "-"
+	}
+	return name
+}
+
+func onOff(b bool) string {
+	if b {
+		return "On"
+	}
+	return "Off"
+}
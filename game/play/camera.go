@@ -0,0 +1,79 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package play
+
+import (
+	"math"
+
+	"github.com/ungerik/go3d/mat4"
+	"github.com/ungerik/go3d/vec3"
+)
+
+const (
+	minPitch = 0.1
+	maxPitch = math.Pi/2 - 0.05
+
+	// mouseLookSpeed is the camera rotation in radians per mouse unit.
+	mouseLookSpeed = 0.005
+)
+
+// orbitCamera looks at a target from a fixed distance. Yaw rotates around
+// the vertical axis and pitch tilts the camera down towards the target.
+type orbitCamera struct {
+	yaw, pitch float32
+}
+
+func (c *orbitCamera) rotate(yaw, pitch float32) {
+	c.yaw += yaw
+	c.pitch += pitch
+
+	if c.pitch < minPitch {
+		c.pitch = minPitch
+	} else if c.pitch > maxPitch {
+		c.pitch = maxPitch
+	}
+}
+
+func (c orbitCamera) lerp(to orbitCamera, t float32) orbitCamera {
+	return orbitCamera{
+		yaw:   c.yaw + (to.yaw-c.yaw)*t,
+		pitch: c.pitch + (to.pitch-c.pitch)*t,
+	}
+}
+
+// viewMatrix assigns the view transform, T(0,0,-dist) * Rx(pitch) * Ry(yaw) * T(-target), to m.
+func (c orbitCamera) viewMatrix(m *mat4.T, target vec3.T, dist float32) {
+	sy, cy := math.Sincos(float64(c.yaw))
+	sp, cp := math.Sincos(float64(c.pitch))
+	sinY, cosY, sinP, cosP := float32(sy), float32(cy), float32(sp), float32(cp)
+
+	rot := [3][3]float32{
+		{cosY, 0, sinY},
+		{sinP * sinY, cosP, -sinP * cosY},
+		{-cosP * sinY, sinP, cosP * cosY},
+	}
+
+	a := m.Array()
+	for col := 0; col < 3; col++ {
+		for row := 0; row < 3; row++ {
+			a[col*4+row] = rot[row][col]
+		}
+		a[col*4+3] = 0
+	}
+
+	for row := 0; row < 3; row++ {
+		a[12+row] = -(rot[row][0]*target[0] + rot[row][1]*target[1] + rot[row][2]*target[2])
+	}
+	a[14] -= dist
+	a[15] = 1
+}
+
+// forward returns the direction the camera looks in.
+func (c orbitCamera) forward() vec3.T {
+	sy, cy := math.Sincos(float64(c.yaw))
+	sp, cp := math.Sincos(float64(c.pitch))
+	return vec3.T{float32(cp * sy), float32(-sp), float32(-cp * cy)}
+}
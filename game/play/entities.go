@@ -0,0 +1,93 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package play
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/andreas-jonsson/voxbox/game/entity"
+	"github.com/andreas-jonsson/voxbox/sprite"
+	"github.com/andreas-jonsson/voxel/voxel"
+	"github.com/ungerik/go3d/vec3"
+)
+
+const (
+	dummyHealth = 3
+	dummySpeed  = 12
+
+	// dummyDistance is how far in front of the player a dummy is dropped.
+	dummyDistance = 32
+
+	animWalk = "walk"
+)
+
+// spawnDummy drops a dummy in front of the player from above the room, like
+// the player is spawned. It is kept inside the room so it can not land in
+// the walls.
+func (s *playState) spawnDummy() {
+	if !s.player.Alive() {
+		return
+	}
+
+	f := s.camera.forward()
+	l := float32(math.Hypot(float64(f[0]), float64(f[2])))
+	if l == 0 {
+		return
+	}
+
+	size := s.model.Size()
+	pos := s.player.Transform.Pos
+	x := pos[0] + f[0]/l*dummyDistance
+	z := pos[2] + f[2]/l*dummyDistance
+
+	e := &entity.Entity{
+		Name:   "dummy",
+		Model:  entity.NewModel(s.model, playerPalette),
+		Body:   &entity.Body{Size: size, Gravity: entity.DefaultGravity},
+		Health: &entity.Health{HP: dummyHealth, Max: dummyHealth},
+	}
+	e.Transform.Pos = vec3.T{
+		float32(math.Max(0, math.Min(float64(x), float64(s.roomSize.X-size.X)))),
+		float32(s.roomSize.Y),
+		float32(math.Max(0, math.Min(float64(z), float64(s.roomSize.Z-size.Z)))),
+	}
+	e.Script = wander(int64(s.world.Spawn(e)))
+}
+
+// wander returns a script that walks in a random direction, turning when
+// blocked or after a while. The direction only depends on seed, so the
+// dummy walks the same way in a replay.
+func wander(seed int64) entity.Script {
+	rnd := rand.New(rand.NewSource(seed))
+	var dir [2]float32
+	var left time.Duration
+
+	return func(w *entity.World, e *entity.Entity, dt time.Duration) {
+		b := e.Body
+		left -= dt
+		if left <= 0 || b.Blocked {
+			a := rnd.Float64() * 2 * math.Pi
+			dir = [2]float32{float32(math.Cos(a)), float32(math.Sin(a))}
+			left = time.Duration(1+rnd.Intn(3)) * time.Second
+		}
+
+		b.Vel[0], b.Vel[2] = dir[0]*dummySpeed, dir[1]*dummySpeed
+		e.Transform.Face(dir[0], dir[1])
+
+		if b.OnGround && !b.Blocked && e.Model.Play(animWalk) {
+			return
+		}
+		e.Model.Play(sprite.Idle)
+	}
+}
+
+// damage hurts the entities within radius of p.
+func (s *playState) damage(p voxel.Point, radius, amount int) {
+	r := voxel.Pt(radius, radius, radius)
+	s.world.Damage(voxel.Box{Min: p.Sub(r), Max: p.Add(r).Add(voxel.Pt(1, 1, 1))}, amount)
+}
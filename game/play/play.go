@@ -6,39 +6,172 @@
 package play
 
 import (
-	"fmt"
-	"image/color/palette"
+	"errors"
+	"image"
+	"image/color"
 	"log"
 	"math"
+	"path"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/andreas-jonsson/voxbox/data"
 	"github.com/andreas-jonsson/voxbox/game"
+	"github.com/andreas-jonsson/voxbox/game/debug"
+	"github.com/andreas-jonsson/voxbox/game/entity"
 	"github.com/andreas-jonsson/voxbox/game/player"
-	"github.com/andreas-jonsson/voxbox/platform"
+	"github.com/andreas-jonsson/voxbox/platform/display"
+	"github.com/andreas-jonsson/voxbox/platform/input"
 	"github.com/andreas-jonsson/voxbox/room"
+	"github.com/andreas-jonsson/voxbox/sprite"
+	"github.com/andreas-jonsson/voxbox/text"
 	"github.com/andreas-jonsson/voxbox/view"
 	"github.com/andreas-jonsson/voxel/voxel"
-	"github.com/andreas-jonsson/voxel/voxel/vox"
 	"github.com/goxjs/gl"
 	"github.com/ungerik/go3d/mat4"
+	"github.com/ungerik/go3d/vec3"
 )
 
+const (
+	roomPalette = iota
+	playerPalette
+)
+
+const (
+	cameraNear = 0.1
+	cameraFar  = 10000
+
+	// cameraSpeed is the camera rotation speed in radians per second.
+	cameraSpeed = 1
+
+	cameraDistance = 260
+	cameraPitch    = math.Pi * 0.33
+
+	// Camera distances where the view is drawn at half and quarter
+	// resolution. With the camera at cameraDistance that is the back of
+	// the view.
+	lodHalfDistance    = 290
+	lodQuarterDistance = 320
+)
+
+const levelDir = "levels"
+
+// overlayInterval is how often the debug overlay queries the room.
+const overlayInterval = time.Second
+
+var defaultRoomSize = voxel.Pt(256, 64, 256)
+
+type Config func(*playState) error
+
+func ConfigWithRoomSize(size voxel.Point) Config {
+	return func(s *playState) error {
+		if size.X <= 0 || size.Y <= 0 || size.Z <= 0 {
+			return errors.New("invalid room size")
+		}
+		s.roomSize = size
+		return nil
+	}
+}
+
+// ConfigWithView sets the configs the view is created with, such as the
+// renderer it draws with.
+func ConfigWithView(configs ...view.Config) Config {
+	return func(s *playState) error {
+		s.viewConfigs = configs
+		return nil
+	}
+}
+
 type playState struct {
-	room   room.Interface
-	view   *view.View
-	player *player.Player
+	gctl     game.GameControl
+	level    string
+	roomSize voxel.Point
+
+	// The camera rotation around the room after the last two updates.
+	camera, lastCamera orbitCamera
+
+	// origin is the position in the room shown at the view origin.
+	origin voxel.Point
+
+	viewportSize image.Point
+	projMatrix   mat4.T
+
+	room        room.Interface
+	view        *view.View
+	viewConfigs []view.Config
+	overlay     *debug.Overlay
+
+	// The overlay shows room values queried at most once per
+	// overlayInterval, the queries wait for the room goroutine.
+	overlayTime time.Time
+	roomStats   room.Stats
+	cursor      voxel.Point
+	cursorValue uint8
+	cursorValid bool
+
+	// world holds the player and the dummies it spawns, both use model.
+	world  *entity.World
+	player *entity.Entity
+	model  *sprite.Sprite
+
+	// The selected tool and color from the room palette.
+	tool    int
+	color   uint8
+	palette color.Palette
+
+	// The HUD is created when it is first drawn.
+	font *text.Font
+	hud  *text.Batch
 }
 
-func NewPlayState() *playState {
-	return &playState{}
+func NewPlayState(configs ...Config) (*playState, error) {
+	s := &playState{roomSize: defaultRoomSize, camera: orbitCamera{pitch: cameraPitch}}
+	for _, cfg := range configs {
+		if err := cfg(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
 func (s *playState) Name() string {
 	return "play"
 }
 
-func loadRoom(r *room.Room, flags room.Flag) {
+func (s *playState) PostEffects() (display.PostEffects, display.PostSettings) {
+	settings := display.DefaultPostSettings
+	settings.Fog.Start = 250
+	settings.Fog.End = 500
+	settings.Fog.Near = cameraNear
+	settings.Fog.Far = cameraFar
+	return display.PostAll, settings
+}
+
+// Levels returns the names of the levels in the data file system.
+func Levels() ([]string, error) {
+	dir, err := data.FS.Open(levelDir)
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+
+	files, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	var levels []string
+	for _, f := range files {
+		if name := f.Name(); !f.IsDir() && path.Ext(name) == ".vox" {
+			levels = append(levels, strings.TrimSuffix(name, ".vox"))
+		}
+	}
+	sort.Strings(levels)
+	return levels, nil
+}
+
+func loadRoom(r *room.Room, level string, flags room.Flag) {
 	voxPos := []voxel.Point{
 		voxel.Pt(0, 0, 0),
 		voxel.Pt(97, 0, 0),
@@ -53,8 +186,9 @@ func loadRoom(r *room.Room, flags room.Flag) {
 		voxel.Pt(194, 0, 194),
 	}
 
-	for i, pos := range voxPos {
-		if err := r.LoadVOXFile(fmt.Sprintf("test%d.vox", i%3), pos, flags); err != nil {
+	file := path.Join(levelDir, level+".vox")
+	for _, pos := range voxPos {
+		if err := r.LoadVOXFile(file, pos, flags); err != nil {
 			log.Panicln(err)
 		}
 	}
@@ -70,116 +204,335 @@ func loadRoom(r *room.Room, flags room.Flag) {
 	*/
 }
 
+// Enter starts the level given as the second argument.
 func (s *playState) Enter(from game.GameState, args ...interface{}) error {
-	r := room.NewRoom(voxel.Pt(256, 64, 256), 16*time.Millisecond)
-	loadRoom(r, room.Flag(room.Attached))
+	if len(args) < 2 {
+		return errors.New("no level given")
+	}
+
+	s.gctl = args[0].(game.GameControl)
+	s.level = args[1].(string)
+
+	// The room is stepped from Update to keep it in sync with the game.
+	r := room.NewRoom(s.roomSize, 0)
+	r.SetEditHook(s.gctl.RecordEdit)
+	loadRoom(r, s.level, room.Flag(room.Attached))
 
-	fp, err := data.FS.Open("test0.vox")
+	v, err := view.NewView(s.viewConfigs...)
 	if err != nil {
 		return err
 	}
-	defer fp.Close()
 
-	img := voxel.NewPaletted(palette.Plan9, voxel.ZB)
-	if err := vox.Decode(fp, img); err != nil {
+	if err := v.SetShadowQuality(view.ShadowsMedium); err != nil {
+		log.Println("Shadows disabled:", err)
+	}
+
+	// The back of the room is far enough away to be drawn at lower resolution.
+	if err := v.SetLODDistances(lodHalfDistance, lodQuarterDistance); err != nil {
 		return err
 	}
+	s.view = v
 
-	v, err := view.NewView()
-	if err != nil {
+	if s.model, err = sprite.Load("player.vox"); err != nil {
 		return err
 	}
 
-	v.SetPalettes(img.Palette)
-	s.view = v
+	r.SetPaletteRow(roomPalette)
+	v.SetPalettes(r.Palette(), s.model.Palette())
 
-	s.room = r.Start()
+	s.overlay = debug.NewOverlay()
+	s.palette = r.Palette()
+	s.tool, s.color = toolDig, 1
 
-	s.player = player.NewPlayer(s.view)
-	s.player.SetRoom(r)
+	s.room = r.Start()
+	s.world = entity.NewWorld(s.room)
+	s.spawn()
 
 	return nil
 }
 
+// spawn drops a new player into the center of the room from above.
+func (s *playState) spawn() {
+	size := s.model.Size()
+	s.player = player.New(s.model, playerPalette, s.playerInput)
+	s.player.Transform.Pos = vec3.T{
+		float32((s.roomSize.X - size.X) / 2),
+		float32(s.roomSize.Y),
+		float32((s.roomSize.Z - size.Z) / 2),
+	}
+	s.world.Spawn(s.player)
+}
+
+// viewOrigin returns the part of the room shown in the view, centered on
+// the player where possible.
+func (s *playState) viewOrigin(pos vec3.T) voxel.Point {
+	size := s.player.Body.Size
+	center := [3]int{int(pos[0]) + size.X/2, int(pos[1]) + size.Y/2, int(pos[2]) + size.Z/2}
+	roomSize := [3]int{s.roomSize.X, s.roomSize.Y, s.roomSize.Z}
+	viewSize := [3]int{view.SizeX, view.SizeY, view.SizeZ}
+
+	var origin [3]int
+	for i := range origin {
+		o := center[i] - viewSize[i]/2
+		if max := roomSize[i] - viewSize[i]; o > max {
+			o = max
+		}
+		if o < 0 {
+			o = 0
+		}
+		origin[i] = o
+	}
+	return voxel.Pt(origin[0], origin[1], origin[2])
+}
+
 func (s *playState) Exit(to game.GameState) error {
 	s.room.Destroy()
 	s.view.Destroy()
+	s.overlay.Destroy()
+	if s.hud != nil {
+		s.hud.Destroy()
+		s.font.Destroy()
+		s.font, s.hud = nil, nil
+	}
 	return nil
 }
 
-var anim = 0.0
+func (s *playState) Pause() {
+	s.room.SetPaused(true)
+}
+
+func (s *playState) Resume() {
+	s.room.SetPaused(false)
+}
+
+// Checksum waits for the room to finish all queued steps and returns the
+// checksum of its voxels.
+func (s *playState) Checksum() uint32 {
+	return <-s.room.Checksum()
+}
+
+// MouseLook captures the mouse to rotate the camera.
+func (s *playState) MouseLook() bool {
+	return true
+}
 
 func (s *playState) Update(gctl game.GameControl) error {
-	dt, tick, _ := gctl.Timing()
+	dt, _, _ := gctl.Timing()
+	actions := gctl.Actions()
+	s.lastCamera = s.camera
 
 	for ev := gctl.PollEvent(); ev != nil; ev = gctl.PollEvent() {
 		switch t := ev.(type) {
-		case *platform.KeyDownEvent:
-			switch t.Key {
-			case platform.KeyReturn:
-				s.player.Die()
-			case platform.KeyLeft:
+		case *input.KeyDownEvent:
+			if t.Key == input.KeyEsc {
+				return gctl.PushState("menu", gctl)
+			}
+		case *input.ControllerButtonEvent:
+			if t.Button == input.ButtonStart && t.Pressed {
+				return gctl.PushState("menu", gctl)
+			}
+		case *input.MouseMotionEvent:
+			s.camera.rotate(t.DX*mouseLookSpeed, t.DY*mouseLookSpeed)
+		case *input.MouseButtonEvent:
+			if t.Type != input.MouseButtonDown {
+				break
+			}
+
+			switch t.Button {
+			case input.MouseLeft:
+				s.useTool()
+			case input.MouseRight:
+				s.nextTool()
+			}
+		case *input.MouseWheelEvent:
+			if t.Y > 0 {
+				s.nextColor(1)
+			} else if t.Y < 0 {
+				s.nextColor(-1)
+			}
+		case *input.ActionEvent:
+			if !t.Pressed {
+				break
+			}
+
+			switch t.Action {
+			case game.ActionDie:
+				s.world.Kill(s.player)
+			case game.ActionOverlay:
+				s.overlay.Toggle()
+			case game.ActionUseTool:
+				s.useTool()
+			case game.ActionNextTool:
+				s.nextTool()
+			case game.ActionNextColor:
+				s.nextColor(1)
+			case game.ActionSpawn:
+				s.spawnDummy()
+			case game.ActionReload:
+				level := s.level
+				s.world.Clear()
 				s.room.Clear()
-				s.room.Send(func(r *room.Room) {
-					loadRoom(r, room.Flag(room.Falling))
+				s.room.Apply(room.Edit{Op: "load", Arg: level}, func(r *room.Room) {
+					loadRoom(r, level, room.Flag(room.Falling))
 				})
+				s.spawn()
 			}
 		}
 	}
 
+	if actions.Pressed(game.ActionCameraLeft) {
+		s.camera.rotate(-cameraSpeed*float32(dt.Seconds()), 0)
+	}
+	if actions.Pressed(game.ActionCameraRight) {
+		s.camera.rotate(cameraSpeed*float32(dt.Seconds()), 0)
+	}
+
+	s.world.Update(dt)
+	s.room.Step()
+
+	return nil
+}
+
+// playerInput returns the movement of the player, relative to the camera.
+func (s *playState) playerInput() player.Input {
+	actions := s.gctl.Actions()
+	var right, forward float32
+	if actions.Pressed(game.ActionForward) {
+		forward++
+	}
+	if actions.Pressed(game.ActionBack) {
+		forward--
+	}
+	if actions.Pressed(game.ActionRight) {
+		right++
+	}
+	if actions.Pressed(game.ActionLeft) {
+		right--
+	}
+
+	sin, cos := math.Sincos(float64(s.camera.yaw))
+	x := right*float32(cos) + forward*float32(sin)
+	z := right*float32(sin) - forward*float32(cos)
+	if l := float32(math.Hypot(float64(x), float64(z))); l > 1 {
+		x, z = x/l, z/l
+	}
+
+	return player.Input{Move: [2]float32{x, z}, Jump: actions.Pressed(game.ActionJump)}
+}
+
+func (s *playState) Render(alpha float32) error {
 	s.view.Clear(0)
 
 	// ------------- update view ----------------
 
-	anim += dt.Seconds() * 10
+	pos := s.player.Transform.Position(alpha)
+	s.origin = s.viewOrigin(pos)
 
-	//<-s.room.Send(func() {
-	//voxel.Blit(s.view, s.room, voxel.Pt(0, 0, int(anim)), s.room.Bounds())
-	//})
+	start := time.Now()
+	viewBox := voxel.Box{Min: s.origin, Max: s.origin.Add(voxel.Pt(view.SizeX, view.SizeY, view.SizeZ))}
+	<-s.room.BlitToView(s.view, voxel.ZP, viewBox)
+	s.overlay.Measure("blit", start)
 
-	<-s.room.BlitToView(s.view, voxel.ZP, s.room.Bounds())
-
-	s.player.Render()
+	s.world.Render(s.view, s.origin, alpha)
 
 	// ------------------------------------------
 
 	s.view.SetGLState()
 
-	const (
-		near        = 0.1
-		far         = 10000
-		angleOfView = 45
-		aspectRatio = 16 / 10
-	)
+	s.updateProjection()
 
-	scale := float32(math.Tan(angleOfView*0.5*math.Pi/180) * near)
-	r := aspectRatio * scale
-	l := -r
-	t := scale
-	b := -t
+	var viewMatrix mat4.T
+	camera := s.lastCamera.lerp(s.camera, alpha)
+	size := s.player.Body.Size
+	target := vec3.T{
+		pos[0] + float32(size.X)/2 - float32(s.origin.X),
+		pos[1] + float32(size.Y)/2 - float32(s.origin.Y),
+		pos[2] + float32(size.Z)/2 - float32(s.origin.Z),
+	}
+	camera.viewMatrix(&viewMatrix, target, cameraDistance)
 
-	var (
-		viewMatrix,
-		projMatrix mat4.T
-	)
+	start = time.Now()
+	s.view.BuildBuffers(&s.projMatrix, &viewMatrix)
+	s.overlay.Measure("build", start)
 
-	/********/
-	rot := float32(tick/time.Millisecond) * 0.0005
-	viewMatrix.AssignEulerRotation(rot, math.Pi*0.25, 0)
-	/********/
+	if s.overlay.Visible() {
+		s.updateOverlay()
+	}
 
-	viewMatrix.AssignEulerRotation(0, math.Pi*0.33, 0)
-	viewMatrix.TranslateY(-20)
-	viewMatrix.TranslateZ(-260)
+	gl.ClearColor(0.6, 0.6, 0.6, 1)
 
-	projMatrix.AssignPerspectiveProjection(l, r, b, t, near, far)
-	s.view.BuildBuffers(&projMatrix, &viewMatrix)
+	defer s.overlay.Measure("render", time.Now())
+	return s.view.Render()
+}
 
-	gl.ClearColor(0.6, 0.6, 0.6, 1)
+// updateProjection rebuilds the projection matrix when the viewport has
+// been resized. The vertical field of view is kept and the horizontal
+// follows the aspect ratio of the viewport.
+func (s *playState) updateProjection() {
+	var viewport [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, viewport[:])
 
+	size := image.Pt(int(viewport[2]), int(viewport[3]))
+	if size == s.viewportSize || size.Y <= 0 {
+		return
+	}
+	s.viewportSize = size
+
+	const angleOfView = 45
+
+	aspectRatio := float32(size.X) / float32(size.Y)
+	t := float32(math.Tan(angleOfView*0.5*math.Pi/180) * cameraNear)
+	r := aspectRatio * t
+
+	s.projMatrix.AssignPerspectiveProjection(-r, r, -t, t, cameraNear, cameraFar)
+}
+
+func (s *playState) RenderOverlay() error {
+	if s.hud == nil {
+		var err error
+		if s.font, s.hud, err = newHUD(); err != nil {
+			return err
+		}
+	}
+
+	s.renderHUD()
+	s.overlay.Render()
 	return nil
 }
 
-func (s *playState) Render() error {
-	return s.view.Render()
+func (s *playState) updateOverlay() {
+	_, _, fps := s.gctl.Timing()
+	o := s.overlay
+
+	o.Printf("%d fps, frame %.2fms", fps, s.gctl.FrameTime().Seconds()*1000)
+
+	vs := s.view.Stats()
+	o.Printf("view voxels: %d", vs.Voxels)
+	o.Printf("vertices: %v + %d", vs.Vertices, vs.TransparentVertices)
+
+	if time.Since(s.overlayTime) >= overlayInterval {
+		s.overlayTime = time.Now()
+		s.roomStats = <-s.room.Stats()
+
+		// The mouse is captured by mouse look, pick at the center of the screen.
+		var p voxel.Point
+		if p, s.cursorValid = s.view.Pick(0, 0); s.cursorValid {
+			s.cursor = p.Add(s.origin)
+			s.cursorValue = <-s.room.Inspect(s.cursor)
+		}
+	}
+
+	rs := s.roomStats
+	o.Printf("room voxels: %d falling: %d", rs.Voxels, rs.Falling)
+	o.Printf("room queue: %d", rs.Queued)
+
+	pos := s.player.Transform.Pos
+	o.Printf("player: %.1f,%.1f,%.1f", pos[0], pos[1], pos[2])
+
+	if p, v := s.cursor, s.cursorValue; s.cursorValid {
+		o.Printf("cursor: %d,%d,%d", p.X, p.Y, p.Z)
+		o.Printf("index: %d falling: %v attached: %v", v&^(room.Falling|room.Attached), v&room.Falling != 0, v&room.Attached != 0)
+	} else {
+		o.Printf("cursor: -")
+	}
 }
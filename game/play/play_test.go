@@ -0,0 +1,223 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package play
+
+import (
+	"errors"
+	"image"
+	"os"
+	"testing"
+
+	"github.com/andreas-jonsson/voxbox/game"
+	"github.com/andreas-jonsson/voxbox/platform/display"
+	"github.com/andreas-jonsson/voxbox/platform/input"
+	"github.com/andreas-jonsson/voxbox/room"
+	"github.com/andreas-jonsson/voxbox/view"
+)
+
+// landTicks is enough updates for the player to land after spawning.
+const landTicks = 2 * game.DefaultTickRate
+
+func TestMain(m *testing.M) {
+	// The data file system of dev builds reads from the repository root.
+	if err := os.Chdir("../.."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// nullRenderer is a platform renderer that draws nothing.
+type nullRenderer struct {
+	effects  display.PostEffects
+	settings display.PostSettings
+	relative bool
+}
+
+func (r *nullRenderer) Clear()                      {}
+func (r *nullRenderer) Present()                    {}
+func (r *nullRenderer) Shutdown()                   {}
+func (r *nullRenderer) ToggleFullscreen()           {}
+func (r *nullRenderer) SetWindowTitle(title string) {}
+
+func (r *nullRenderer) Screenshot() (*image.RGBA, error) {
+	return nil, errors.New("no screen")
+}
+
+func (r *nullRenderer) SaveScreenshot() {}
+
+func (r *nullRenderer) StartRecording(format display.RecordFormat) error {
+	return errors.New("no screen")
+}
+
+func (r *nullRenderer) StopRecording() (string, error) {
+	return "", errors.New("not recording")
+}
+
+func (r *nullRenderer) Recording() bool                                       { return false }
+func (r *nullRenderer) SetRelativeMouse(enabled bool)                         { r.relative = enabled }
+func (r *nullRenderer) RelativeMouse() bool                                   { return r.relative }
+func (r *nullRenderer) SetMouseSensitivity(sensitivity float32, invertY bool) {}
+func (r *nullRenderer) SetPostEffects(effects display.PostEffects)            { r.effects = effects }
+func (r *nullRenderer) PostEffects() display.PostEffects                      { return r.effects }
+func (r *nullRenderer) SetPostSettings(settings display.PostSettings)         { r.settings = settings }
+func (r *nullRenderer) PostSettings() display.PostSettings                    { return r.settings }
+func (r *nullRenderer) PostProcess()                                          {}
+
+// testSource returns scripted events and keeps the room edits.
+type testSource struct {
+	*game.ScriptedSource
+	edits []room.Edit
+}
+
+func (s *testSource) RecordEdit(tick uint64, e room.Edit) {
+	s.edits = append(s.edits, e)
+}
+
+func (s *testSource) Finish(checksum uint32, ok bool) error {
+	return nil
+}
+
+func (s *testSource) count(op string) int {
+	n := 0
+	for _, e := range s.edits {
+		if e.Op == op {
+			n++
+		}
+	}
+	return n
+}
+
+// newTestGame enters the play state of a game driven by src. The view is
+// drawn by the software renderer, no window or GL context is needed.
+func newTestGame(t *testing.T, src *testSource) (*game.Game, *playState) {
+	s, err := NewPlayState(ConfigWithView(view.ConfigWithRenderer(view.NewSoftwareRenderer(64, 48))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states := map[string]game.GameState{s.Name(): s}
+	g, err := game.NewGame(&nullRenderer{}, game.DefaultSettings(), states, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := g.SwitchState(s.Name(), g, "test0"); err != nil {
+		t.Fatal(err)
+	}
+	return g, s
+}
+
+// run steps the game ticks times.
+func run(t *testing.T, g *game.Game, ticks int) {
+	for i := 0; i < ticks; i++ {
+		if err := g.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMouseLook(t *testing.T) {
+	src := &testSource{ScriptedSource: game.NewScriptedSource()}
+	src.Add(1, &input.MouseMotionEvent{DX: 10})
+
+	g, s := newTestGame(t, src)
+	defer s.Exit(nil)
+	defer g.Shutdown()
+
+	yaw := s.camera.yaw
+	run(t, g, 2)
+	if s.camera.yaw <= yaw {
+		t.Errorf("camera yaw changed from %v to %v, expected increasing yaw", yaw, s.camera.yaw)
+	}
+}
+
+func TestActions(t *testing.T) {
+	src := &testSource{ScriptedSource: game.NewScriptedSource()}
+	src.Add(1, &input.KeyDownEvent{Key: input.KeyR}, &input.KeyUpEvent{Key: input.KeyR})
+	src.Add(5, &input.KeyDownEvent{Key: input.KeyReturn}, &input.KeyUpEvent{Key: input.KeyReturn})
+
+	g, s := newTestGame(t, src)
+	defer s.Exit(nil)
+	defer g.Shutdown()
+
+	// The player is left in the room when the die animation has played.
+	run(t, g, landTicks)
+
+	if n := src.count("load"); n != 1 {
+		t.Errorf("%d load edits, expected 1", n)
+	}
+	if n := src.count("die"); n != 1 {
+		t.Errorf("%d die edits, expected 1", n)
+	}
+	if src.Len() != 0 {
+		t.Errorf("%d events were not consumed", src.Len())
+	}
+}
+
+func TestPlayerMovement(t *testing.T) {
+	src := &testSource{ScriptedSource: game.NewScriptedSource()}
+	src.Add(landTicks, &input.KeyDownEvent{Key: input.KeyW})
+	src.Add(landTicks+30, &input.KeyUpEvent{Key: input.KeyW})
+
+	g, s := newTestGame(t, src)
+	defer s.Exit(nil)
+	defer g.Shutdown()
+
+	// Let the player land before walking.
+	run(t, g, landTicks)
+	start := s.player.Transform.Pos
+	if !s.player.Body.OnGround {
+		t.Errorf("player has not landed at %v", start)
+	}
+
+	run(t, g, 40)
+	end := s.player.Transform.Pos
+
+	// The camera looks along -z, forward moves the player away from it.
+	if end[2] >= start[2] {
+		t.Errorf("player moved from %v to %v, expected decreasing z", start, end)
+	}
+	if end[0] != start[0] {
+		t.Errorf("player moved sideways from %v to %v", start, end)
+	}
+}
+
+func TestRoomEdits(t *testing.T) {
+	src := &testSource{ScriptedSource: game.NewScriptedSource()}
+	left := &input.MouseButtonEvent{Button: input.MouseLeft, Type: input.MouseButtonDown}
+	right := &input.MouseButtonEvent{Button: input.MouseRight, Type: input.MouseButtonDown}
+
+	// Place a voxel, then cycle past paint back to dig and dig it out.
+	src.Add(landTicks, right)
+	src.Add(landTicks+5, left)
+	src.Add(landTicks+10, right)
+	src.Add(landTicks+15, right)
+	src.Add(landTicks+20, left)
+
+	g, s := newTestGame(t, src)
+	defer s.Exit(nil)
+	defer g.Shutdown()
+
+	// The tools reach the ground in front of the player once it has landed.
+	run(t, g, landTicks)
+	before := s.Checksum()
+
+	run(t, g, 25)
+	after := s.Checksum()
+
+	if n := src.count("dig"); n != 1 {
+		t.Errorf("%d dig edits, expected 1", n)
+	}
+	if n := src.count("place"); n != 1 {
+		t.Errorf("%d place edits, expected 1", n)
+	}
+	if before == after {
+		t.Error("room checksum did not change")
+	}
+	if s.tool != toolDig {
+		t.Errorf("tool %s selected, expected %s", toolNames[s.tool], toolNames[toolDig])
+	}
+}
@@ -0,0 +1,135 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package play
+
+import (
+	"image/color"
+	"strconv"
+
+	"github.com/andreas-jonsson/voxbox/room"
+	"github.com/andreas-jonsson/voxbox/text"
+	"github.com/goxjs/gl"
+	"github.com/ungerik/go3d/vec3"
+)
+
+const (
+	toolDig = iota
+	toolPlace
+	toolPaint
+	numTools
+)
+
+var toolNames = [numTools]string{"Dig", "Place", "Paint"}
+
+const (
+	digRadius = 2
+
+	// toolReach is how far from the center of the player the tools reach.
+	toolReach = 48
+)
+
+var hudColor = color.RGBA{255, 255, 255, 255}
+
+// useTool applies the selected tool to the voxel in the center of the
+// screen.
+func (s *playState) useTool() {
+	if !s.player.Alive() {
+		return
+	}
+
+	size, pos := s.player.Body.Size, s.player.Transform.Pos
+	target := vec3.T{pos[0] + float32(size.X)/2, pos[1] + float32(size.Y)/2, pos[2] + float32(size.Z)/2}
+
+	// The ray starts at the player, voxels between it and the camera are
+	// out of reach.
+	hit := <-s.room.Raycast(target, s.camera.forward(), toolReach)
+	if hit == nil {
+		return
+	}
+
+	p, index := hit.Pos, s.color
+	arg := strconv.Itoa(int(index))
+
+	switch s.tool {
+	case toolDig:
+		s.room.Apply(room.Edit{Op: "dig", At: p}, func(r *room.Room) {
+			r.Dig(p, digRadius)
+		})
+		s.damage(p, digRadius, 1)
+	case toolPlace:
+		at := p.Add(hit.Normal)
+		if at.In(s.player.Body.Bounds(&s.player.Transform)) {
+			return
+		}
+		s.room.Apply(room.Edit{Op: "place", At: at, Arg: arg}, func(r *room.Room) {
+			r.Place(at, p, index)
+		})
+	case toolPaint:
+		s.room.Apply(room.Edit{Op: "paint", At: p, Arg: arg}, func(r *room.Room) {
+			r.Paint(p, index)
+		})
+	}
+}
+
+func (s *playState) nextTool() {
+	s.tool = (s.tool + 1) % numTools
+}
+
+// nextColor selects the next palette color, skipping the empty index.
+func (s *playState) nextColor(dir int) {
+	c := (int(s.color)-1+dir+room.MaxColor)%room.MaxColor + 1
+	s.color = uint8(c)
+}
+
+// renderHUD draws a crosshair and the selected tool and color.
+func (s *playState) renderHUD() {
+	var viewport [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, viewport[:])
+
+	scale := int(viewport[3]) / 240
+	if scale < 1 {
+		scale = 1
+	}
+
+	cross := s.font.Measure("+", scale)
+	s.hud.DrawShadow((int(viewport[2])-cross.X)/2, (int(viewport[3])-cross.Y)/2, scale, hudColor, "+")
+
+	label := toolNames[s.tool]
+	if s.tool != toolDig {
+		label += " "
+	}
+	size := s.font.Measure(label, scale)
+	x, y := cross.X, int(viewport[3])-size.Y-cross.Y
+	s.hud.DrawShadow(x, y, scale, hudColor, label)
+
+	if s.tool != toolDig {
+		s.hud.DrawShadow(x+size.X, y, scale, s.swatchColor(), "#")
+	}
+	s.hud.Flush()
+}
+
+// swatchColor returns the selected color from the room palette.
+func (s *playState) swatchColor() color.RGBA {
+	if int(s.color) >= len(s.palette) {
+		return hudColor
+	}
+	r, g, b, _ := s.palette[s.color].RGBA()
+	return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 255}
+}
+
+func newHUD() (*text.Font, *text.Batch, error) {
+	font, err := text.LoadFont(text.DefaultFont)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	batch, err := text.NewBatch(font)
+	if err != nil {
+		font.Destroy()
+		return nil, nil, err
+	}
+	return font, batch, nil
+}
@@ -6,67 +6,57 @@
 package player
 
 import (
-	"log"
+	"time"
 
-	"github.com/andreas-jonsson/voxbox/data"
-	"github.com/andreas-jonsson/voxbox/room"
-	"github.com/andreas-jonsson/voxel/voxel"
-	"github.com/andreas-jonsson/voxel/voxel/vox"
+	"github.com/andreas-jonsson/voxbox/game/entity"
+	"github.com/andreas-jonsson/voxbox/sprite"
 )
 
-type Player struct {
-	image voxel.Paletted
-	view  voxel.Image
-	room  room.Interface
-	alive bool
-}
+// Name of the player entity.
+const Name = "player"
 
-func NewPlayer(view voxel.Image) *Player {
-	p := &Player{view: view, alive: true}
+// Animation of the player model, besides the idle and die animations.
+const animWalk = "walk"
 
-	fp, err := data.FS.Open("player.vox")
-	if err != nil {
-		log.Panicln(err)
-	}
-	defer fp.Close()
+// Movement in voxels per second.
+const (
+	walkSpeed = 24
+	jumpSpeed = 36
+)
 
-	p.image.Transformer = func(x, y, z int) (int, int, int) {
-		return x, z, y
-	}
+// Input is the movement requested for one update. Move is the direction
+// to walk in along the x and z axis, with a length of at most one.
+type Input struct {
+	Move [2]float32
+	Jump bool
+}
 
-	if err := vox.Decode(fp, &p.image); err != nil {
-		log.Panicln(err)
+// New returns a player entity with the model s, rendered with palette row.
+// The player is controlled by input, which is called every update.
+func New(s *sprite.Sprite, row uint8, input func() Input) *entity.Entity {
+	return &entity.Entity{
+		Name:   Name,
+		Model:  entity.NewModel(s, row),
+		Body:   &entity.Body{Size: s.Size(), Gravity: entity.DefaultGravity},
+		Script: control(input),
 	}
-
-	return p
 }
 
-func (p *Player) SetRoom(r room.Interface) {
-	p.room = r
-}
+// control returns the script that moves the player by input.
+func control(input func() Input) entity.Script {
+	return func(w *entity.World, e *entity.Entity, dt time.Duration) {
+		in, b := input(), e.Body
 
-func (p *Player) blit(dst voxel.Image) {
-	voxel.BlitOp(dst, &p.image, voxel.ZP, p.image.Bounds(), func(dst, src voxel.Image, dx, dy, dz, sx, sy, sz int) {
-		c := src.Get(sx, sy, sz)
-		if c > 0 {
-			dst.Set(dx, dy, dz, c)
+		b.Vel[0] = in.Move[0] * walkSpeed
+		b.Vel[2] = in.Move[1] * walkSpeed
+		if in.Jump && b.OnGround {
+			b.Vel[1] = jumpSpeed
 		}
-	})
-}
-
-func (p *Player) Die() {
-	if p.alive {
-		p.alive = false
-
-		// 	Do not wait for result.
-		p.room.Send(func(r *room.Room) {
-			p.blit(r)
-		})
-	}
-}
+		e.Transform.Face(in.Move[0], in.Move[1])
 
-func (p *Player) Render() {
-	if p.alive {
-		p.blit(p.view)
+		if b.OnGround && (in.Move[0] != 0 || in.Move[1] != 0) && e.Model.Play(animWalk) {
+			return
+		}
+		e.Model.Play(sprite.Idle)
 	}
 }
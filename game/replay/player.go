@@ -0,0 +1,164 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+
+	"github.com/andreas-jonsson/voxbox/game"
+	"github.com/andreas-jonsson/voxbox/platform/input"
+	"github.com/andreas-jonsson/voxbox/room"
+)
+
+type recordedEvent struct {
+	tick  uint64
+	event input.Event
+}
+
+type recordedEdit struct {
+	tick uint64
+	edit room.Edit
+}
+
+// Player replays a recording. Room edits made by the game are compared to
+// the recorded edits and the room checksum is compared when the game shuts
+// down. Live input is ignored except for quit events.
+type Player struct {
+	live     game.EventSource
+	settings game.Settings
+	events   []recordedEvent
+	edits    []recordedEdit
+	checksum *uint32
+	ended    bool
+	diverged bool
+}
+
+// Open reads a recording. The game must use the settings of the player to
+// replay it.
+func Open(file string, live game.EventSource) (*Player, error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	dec := json.NewDecoder(fp)
+
+	var h header
+	if err := dec.Decode(&h); err != nil {
+		return nil, err
+	}
+	if h.Version != version {
+		return nil, fmt.Errorf("unsupported recording version: %d", h.Version)
+	}
+
+	p := &Player{live: live, settings: h.Settings}
+	for {
+		var e entry
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case e.End:
+			p.checksum, p.ended = e.Checksum, true
+		case e.Edit != nil:
+			p.edits = append(p.edits, recordedEdit{e.Tick, *e.Edit})
+		default:
+			t, ok := eventTypes[e.Type]
+			if !ok {
+				return nil, fmt.Errorf("unknown event type: %s", e.Type)
+			}
+
+			ev := reflect.New(t).Interface()
+			if err := json.Unmarshal(e.Event, ev); err != nil {
+				return nil, err
+			}
+			p.events = append(p.events, recordedEvent{e.Tick, ev})
+		}
+	}
+
+	log.Printf("Replaying session: %s, %d events", file, len(p.events))
+	return p, nil
+}
+
+// Settings returns the settings the session was recorded with. They are
+// read-only to not replace the settings of the user.
+func (p *Player) Settings() *game.Settings {
+	s := p.settings.Clone()
+	s.SetReadOnly()
+	return s
+}
+
+func (p *Player) PollEvent(tick uint64) input.Event {
+	for ev := p.live.PollEvent(tick); ev != nil; ev = p.live.PollEvent(tick) {
+		if _, ok := ev.(*input.QuitEvent); ok {
+			return ev
+		}
+	}
+
+	if len(p.events) == 0 || p.events[0].tick > tick {
+		return nil
+	}
+
+	ev := p.events[0].event
+	p.events = p.events[1:]
+	if len(p.events) == 0 {
+		log.Println("Replay finished at tick", tick)
+	}
+	return ev
+}
+
+// RecordEdit logs the first edit that does not match the recording.
+func (p *Player) RecordEdit(tick uint64, e room.Edit) {
+	if p.diverged {
+		return
+	}
+
+	if len(p.edits) == 0 {
+		log.Printf("Replay diverged at tick %d: unexpected edit %v", tick, e)
+		p.diverged = true
+		return
+	}
+
+	rec := p.edits[0]
+	p.edits = p.edits[1:]
+	if rec.tick != tick || rec.edit != e {
+		log.Printf("Replay diverged at tick %d: edit %v, recorded %v at tick %d", tick, e, rec.edit, rec.tick)
+		p.diverged = true
+	}
+}
+
+// Finish returns an error if the room does not match the recording. The
+// replay fails if either the recording or the replay has no checksum.
+func (p *Player) Finish(checksum uint32, ok bool) error {
+	if len(p.events) > 0 {
+		return fmt.Errorf("replay stopped with %d events left", len(p.events))
+	}
+	if !p.ended {
+		return errors.New("recording is incomplete")
+	}
+	if p.checksum == nil {
+		return errors.New("recording has no checksum")
+	}
+	if !ok {
+		return errors.New("replay has no checksum")
+	}
+	if checksum != *p.checksum {
+		return fmt.Errorf("room checksum %08x does not match the recording %08x", checksum, *p.checksum)
+	}
+
+	log.Println("Replay matches the recording")
+	return nil
+}
@@ -0,0 +1,93 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package replay
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/andreas-jonsson/voxbox/game"
+	"github.com/andreas-jonsson/voxbox/platform/input"
+	"github.com/andreas-jonsson/voxbox/room"
+)
+
+// Recorder records the events of another source and the room edits.
+type Recorder struct {
+	src game.EventSource
+	fp  *os.File
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder creates file and writes the session settings to it.
+func NewRecorder(file string, src game.EventSource, settings *game.Settings) (*Recorder, error) {
+	fp, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{src: src, fp: fp, enc: json.NewEncoder(fp)}
+	if err := r.enc.Encode(header{Version: version, Settings: *settings}); err != nil {
+		fp.Close()
+		return nil, err
+	}
+
+	log.Println("Recording session:", file)
+	return r, nil
+}
+
+// PollEvent records the events of the source, except capture keys.
+func (r *Recorder) PollEvent(tick uint64) input.Event {
+	ev := r.src.PollEvent(tick)
+	if ev == nil || game.IsCaptureKey(ev) {
+		return ev
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		r.fail(err)
+		return ev
+	}
+
+	r.write(entry{Tick: tick, Type: typeName(ev), Event: data})
+	return ev
+}
+
+func (r *Recorder) RecordEdit(tick uint64, e room.Edit) {
+	r.write(entry{Tick: tick, Edit: &e})
+}
+
+// Finish writes the end of the session, with the checksum if ok is true,
+// and closes the file. It returns the first error of the recording.
+func (r *Recorder) Finish(checksum uint32, ok bool) error {
+	e := entry{End: true}
+	if ok {
+		e.Checksum = &checksum
+	}
+
+	r.write(e)
+	if err := r.fp.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+func (r *Recorder) write(e entry) {
+	if r.err == nil {
+		if err := r.enc.Encode(e); err != nil {
+			r.fail(err)
+		}
+	}
+}
+
+// fail keeps the first error, the recording is incomplete after it.
+func (r *Recorder) fail(err error) {
+	if r.err == nil {
+		log.Println("Recording failed:", err)
+		r.err = err
+	}
+}
@@ -0,0 +1,69 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+// Package replay records the events and room edits of a session to a file
+// and replays them through the game. A recording starts with the settings
+// of the session followed by one JSON entry per line in tick order, and
+// ends with the checksum of the room, if the session had one.
+package replay
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/andreas-jonsson/voxbox/game"
+	"github.com/andreas-jonsson/voxbox/platform/input"
+	"github.com/andreas-jonsson/voxbox/room"
+)
+
+const version = 2
+
+type header struct {
+	Version  int
+	Settings game.Settings
+}
+
+// entry is an event, a room edit or the end of the session. The end has
+// no checksum if the session did not have one.
+type entry struct {
+	Tick     uint64
+	Type     string          `json:",omitempty"`
+	Event    json.RawMessage `json:",omitempty"`
+	Edit     *room.Edit      `json:",omitempty"`
+	End      bool            `json:",omitempty"`
+	Checksum *uint32         `json:",omitempty"`
+}
+
+// eventTypes holds the events that can be recorded, by type name.
+var eventTypes = make(map[string]reflect.Type)
+
+func init() {
+	for _, ev := range []input.Event{
+		&input.QuitEvent{},
+		&input.WindowResizeEvent{},
+		&input.KeyUpEvent{},
+		&input.KeyDownEvent{},
+		&input.TextInputEvent{},
+		&input.ControllerDeviceEvent{},
+		&input.ControllerButtonEvent{},
+		&input.ControllerAxisEvent{},
+		&input.MouseWheelEvent{},
+		&input.MouseMotionEvent{},
+		&input.MouseButtonEvent{},
+	} {
+		t := reflect.TypeOf(ev).Elem()
+		eventTypes[t.Name()] = t
+	}
+}
+
+// typeName returns the name events of the same type as ev are recorded
+// with. Events are recorded as pointers, the same as the platform sends.
+func typeName(ev input.Event) string {
+	t := reflect.TypeOf(ev)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
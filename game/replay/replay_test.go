@@ -0,0 +1,149 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package replay
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreas-jonsson/voxbox/game"
+	"github.com/andreas-jonsson/voxbox/platform/input"
+	"github.com/andreas-jonsson/voxbox/room"
+	"github.com/andreas-jonsson/voxel/voxel"
+)
+
+const (
+	testTicks    = 60
+	testRoomSize = 16
+)
+
+// runSession drives a plain room with the events of src for testTicks
+// updates. Every key press drops a voxel in the room.
+func runSession(src game.SessionSource) uint32 {
+	var tick uint64
+
+	r := room.NewRoom(voxel.Pt(testRoomSize, testRoomSize, testRoomSize), 0)
+	r.SetEditHook(func(e room.Edit) {
+		src.RecordEdit(tick, e)
+	})
+	ri := r.Start()
+	defer ri.Destroy()
+
+	for ; tick < testTicks; tick++ {
+		for ev := src.PollEvent(tick); ev != nil; ev = src.PollEvent(tick) {
+			if k, ok := ev.(*input.KeyDownEvent); ok && !game.IsCaptureKey(ev) {
+				at := voxel.Pt(k.Key%testRoomSize, testRoomSize-1, int(tick%testRoomSize))
+				ri.Apply(room.Edit{Op: "drop", At: at}, func(r *room.Room) {
+					r.Set(at.X, at.Y, at.Z, 1)
+				})
+			}
+		}
+		ri.Step()
+	}
+	return <-ri.Checksum()
+}
+
+// record runs a session with a few key presses and screenshots and records
+// it to a new file. It returns the file and the checksum of the room.
+func record(t *testing.T, withChecksum bool) (string, uint32) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "session.rec")
+
+	src := game.NewScriptedSource()
+	src.Add(1, &input.KeyDownEvent{Key: input.KeyA}, &input.KeyUpEvent{Key: input.KeyA})
+	src.Add(5, &input.KeyDownEvent{Key: input.KeyF12}, &input.KeyUpEvent{Key: input.KeyF12})
+	src.Add(10, &input.KeyDownEvent{Key: input.KeyS}, &input.MouseMotionEvent{DX: 2, DY: -1})
+	src.Add(12, &input.KeyDownEvent{Key: input.KeyF9})
+	src.Add(30, &input.KeyDownEvent{Key: input.KeyD})
+
+	rec, err := NewRecorder(file, src, game.DefaultSettings())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checksum := runSession(rec)
+	if err := rec.Finish(checksum, withChecksum); err != nil {
+		t.Fatal(err)
+	}
+	return file, checksum
+}
+
+func TestRoundTrip(t *testing.T) {
+	file, checksum := record(t, true)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	p, err := Open(file, game.NewScriptedSource())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Capture keys are handled by the game and not part of the session.
+	for _, ev := range p.events {
+		if game.IsCaptureKey(ev.event) {
+			t.Errorf("capture key recorded at tick %d: %#v", ev.tick, ev.event)
+		}
+	}
+	if n := len(p.events); n != 5 {
+		t.Errorf("recorded %d events, expected 5", n)
+	}
+	if n := len(p.edits); n != 3 {
+		t.Errorf("recorded %d edits, expected 3", n)
+	}
+
+	replayed := runSession(p)
+	if p.diverged {
+		t.Error("replay diverged")
+	}
+	if replayed != checksum {
+		t.Errorf("replay checksum %08x, recorded %08x", replayed, checksum)
+	}
+	if err := p.Finish(replayed, true); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFinish(t *testing.T) {
+	withChecksum, checksum := record(t, true)
+	defer os.RemoveAll(filepath.Dir(withChecksum))
+
+	withoutChecksum, _ := record(t, false)
+	defer os.RemoveAll(filepath.Dir(withoutChecksum))
+
+	tests := []struct {
+		name     string
+		file     string
+		checksum uint32
+		ok       bool
+		fails    bool
+	}{
+		{"match", withChecksum, checksum, true, false},
+		{"mismatch", withChecksum, checksum + 1, true, true},
+		{"replay without checksum", withChecksum, checksum, false, true},
+		{"recording without checksum", withoutChecksum, checksum, true, true},
+	}
+
+	for _, tt := range tests {
+		p, err := Open(tt.file, game.NewScriptedSource())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Consume the recorded events, the checksum is passed in.
+		for tick := uint64(0); tick < testTicks; tick++ {
+			for p.PollEvent(tick) != nil {
+			}
+		}
+
+		if err := p.Finish(tt.checksum, tt.ok); (err != nil) != tt.fails {
+			t.Errorf("%s: Finish returned %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/andreas-jonsson/voxbox/platform/input"
+)
+
+// SettingsFile is the name of the settings file in the config path.
+const SettingsFile = "settings.json"
+
+// Actions that can be bound to keys.
+const (
+	ActionDie         = "die"
+	ActionReload      = "reload"
+	ActionOverlay     = "overlay"
+	ActionCameraLeft  = "camera_left"
+	ActionCameraRight = "camera_right"
+	ActionForward     = "forward"
+	ActionBack        = "back"
+	ActionLeft        = "left"
+	ActionRight       = "right"
+	ActionJump        = "jump"
+	ActionUseTool     = "use_tool"
+	ActionNextTool    = "next_tool"
+	ActionNextColor   = "next_color"
+	ActionSpawn       = "spawn"
+)
+
+var Actions = []string{
+	ActionForward, ActionBack, ActionLeft, ActionRight, ActionJump,
+	ActionUseTool, ActionNextTool, ActionNextColor, ActionSpawn,
+	ActionDie, ActionReload, ActionOverlay, ActionCameraLeft, ActionCameraRight,
+}
+
+// Settings are persisted in the config path. Display settings are applied
+// when the renderer is created. A zero window size uses the desktop size and
+// an empty level starts the game in the menu.
+type Settings struct {
+	WindowWidth,
+	WindowHeight int
+	ResolutionDiv int
+	VSync         bool
+	Fullscreen    bool
+	Debug         bool
+	RoomSize      Size
+	TickRate      int
+	Level         string
+	DeadZone      float32
+
+	MouseSensitivity float32
+	InvertMouse      bool
+
+	Keys    map[string]string
+	Buttons map[string]string
+
+	// readOnly settings are not written by Save, other settings are written
+	// to the file they were loaded from.
+	readOnly bool
+	file     string
+}
+
+// Size is the dimensions of a box, written as WxHxD.
+type Size [3]int
+
+func (s *Size) String() string {
+	return fmt.Sprintf("%dx%dx%d", s[0], s[1], s[2])
+}
+
+// Set implements flag.Value.
+func (s *Size) Set(v string) error {
+	var sz Size
+	if _, err := fmt.Sscanf(v, "%dx%dx%d", &sz[0], &sz[1], &sz[2]); err != nil {
+		return err
+	}
+	if sz[0] <= 0 || sz[1] <= 0 || sz[2] <= 0 {
+		return fmt.Errorf("invalid size: %s", v)
+	}
+
+	*s = sz
+	return nil
+}
+
+func DefaultSettings() *Settings {
+	return &Settings{
+		ResolutionDiv: 2,
+		RoomSize:      Size{256, 64, 256},
+		TickRate:      DefaultTickRate,
+		DeadZone:      input.DefaultDeadZone,
+
+		MouseSensitivity: 1,
+
+		Keys: map[string]string{
+			ActionDie:         input.KeyName(input.KeyReturn),
+			ActionReload:      input.KeyName(input.KeyR),
+			ActionOverlay:     input.KeyName(input.KeyF3),
+			ActionCameraLeft:  input.KeyName(input.KeyLeft),
+			ActionCameraRight: input.KeyName(input.KeyRight),
+			ActionForward:     input.KeyName(input.KeyW),
+			ActionBack:        input.KeyName(input.KeyS),
+			ActionLeft:        input.KeyName(input.KeyA),
+			ActionRight:       input.KeyName(input.KeyD),
+			ActionJump:        input.KeyName(input.KeySpace),
+			ActionUseTool:     input.KeyName(input.KeyF),
+			ActionNextTool:    input.KeyName(input.KeyTab),
+			ActionNextColor:   input.KeyName(input.KeyC),
+			ActionSpawn:       input.KeyName(input.KeyG),
+		},
+		Buttons: map[string]string{
+			ActionDie:         input.KeyName(input.PadB),
+			ActionReload:      input.KeyName(input.PadY),
+			ActionOverlay:     input.KeyName(input.PadBack),
+			ActionCameraLeft:  input.KeyName(input.PadRightStickLeft),
+			ActionCameraRight: input.KeyName(input.PadRightStickRight),
+			ActionForward:     input.KeyName(input.PadLeftStickUp),
+			ActionBack:        input.KeyName(input.PadLeftStickDown),
+			ActionLeft:        input.KeyName(input.PadLeftStickLeft),
+			ActionRight:       input.KeyName(input.PadLeftStickRight),
+			ActionJump:        input.KeyName(input.PadA),
+			ActionUseTool:     input.KeyName(input.PadRightTrigger),
+			ActionNextTool:    input.KeyName(input.PadRightShoulder),
+			ActionNextColor:   input.KeyName(input.PadLeftShoulder),
+			ActionSpawn:       input.KeyName(input.PadX),
+		},
+	}
+}
+
+// LoadSettings reads the settings file, missing values are taken from the
+// default settings. The settings are saved to the same file.
+func LoadSettings(file string) (*Settings, error) {
+	s := DefaultSettings()
+	s.file = file
+
+	fp, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+	defer fp.Close()
+
+	if err := json.NewDecoder(fp).Decode(s); err != nil {
+		s = DefaultSettings()
+		s.file = file
+		return s, err
+	}
+
+	s.validate()
+	return s, nil
+}
+
+// validate replaces invalid values with the defaults.
+func (s *Settings) validate() {
+	def := DefaultSettings()
+	if s.ResolutionDiv <= 0 {
+		s.ResolutionDiv = def.ResolutionDiv
+	}
+	if s.RoomSize[0] <= 0 || s.RoomSize[1] <= 0 || s.RoomSize[2] <= 0 {
+		s.RoomSize = def.RoomSize
+	}
+	if s.TickRate <= 0 {
+		s.TickRate = def.TickRate
+	}
+	if s.DeadZone < 0 || s.DeadZone >= 1 {
+		s.DeadZone = def.DeadZone
+	}
+	if s.MouseSensitivity <= 0 {
+		s.MouseSensitivity = def.MouseSensitivity
+	}
+
+	if s.Keys == nil {
+		s.Keys = make(map[string]string)
+	}
+	if s.Buttons == nil {
+		s.Buttons = make(map[string]string)
+	}
+
+	// The capture keys are handled by the game and can not be bound.
+	for action, k := range s.Keys {
+		if isCaptureKey(input.KeyFromName(k)) {
+			delete(s.Keys, action)
+		}
+	}
+	addDefaultBindings(s.Keys, def.Keys)
+	addDefaultBindings(s.Buttons, def.Buttons)
+}
+
+// addDefaultBindings binds new actions to their default input unless it is
+// already in use.
+func addDefaultBindings(bindings, def map[string]string) {
+	for _, action := range Actions {
+		if _, ok := bindings[action]; !ok && !isBound(bindings, def[action]) {
+			bindings[action] = def[action]
+		}
+	}
+}
+
+func isBound(bindings map[string]string, input string) bool {
+	for _, k := range bindings {
+		if k == input {
+			return true
+		}
+	}
+	return false
+}
+
+// Clone returns a copy of the settings that does not share the bindings.
+func (s *Settings) Clone() *Settings {
+	c := *s
+	c.Keys = cloneBindings(s.Keys)
+	c.Buttons = cloneBindings(s.Buttons)
+	return &c
+}
+
+func cloneBindings(bindings map[string]string) map[string]string {
+	if bindings == nil {
+		return nil
+	}
+
+	c := make(map[string]string, len(bindings))
+	for action, k := range bindings {
+		c[action] = k
+	}
+	return c
+}
+
+// SetReadOnly stops Save from writing the settings, for settings that do not
+// belong to the user such as those of a replay.
+func (s *Settings) SetReadOnly() {
+	s.readOnly = true
+}
+
+func (s *Settings) Save() error {
+	if s.readOnly {
+		return nil
+	}
+	if s.file == "" {
+		return errors.New("settings were not loaded from a file")
+	}
+
+	fp, err := os.Create(s.file)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	enc := json.NewEncoder(fp)
+	enc.SetIndent("", "\t")
+	return enc.Encode(s)
+}
+
+// Bind binds a key, or gamepad input, to action. Each action has one key
+// and one gamepad input. Other actions bound to the same input are unbound.
+// The capture keys are reserved and can not be bound.
+func (s *Settings) Bind(action string, key int) error {
+	if isCaptureKey(key) {
+		return fmt.Errorf("%s is reserved", input.KeyName(key))
+	}
+
+	bindings := s.Keys
+	if input.IsPadInput(key) {
+		bindings = s.Buttons
+	}
+
+	name := input.KeyName(key)
+	for a, k := range bindings {
+		if k == name {
+			bindings[a] = ""
+		}
+	}
+	bindings[action] = name
+	return nil
+}
+
+// ApplyBindings replaces the bindings in m with the bindings in the settings.
+func (s *Settings) ApplyBindings(m *input.ActionMap) {
+	for _, action := range Actions {
+		m.Unbind(action)
+		m.Bind(action, input.KeyFromName(s.Keys[action]))
+		m.Bind(action, input.KeyFromName(s.Buttons[action]))
+	}
+}
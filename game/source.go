@@ -0,0 +1,80 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package game
+
+import (
+	"github.com/andreas-jonsson/voxbox/platform/input"
+	"github.com/andreas-jonsson/voxbox/room"
+)
+
+type (
+	// EventSource provides the events consumed by the game. Tick is the
+	// number of updates since the game started.
+	EventSource interface {
+		PollEvent(tick uint64) input.Event
+	}
+
+	// SessionSource is implemented by event sources that record or replay
+	// a session. Room edits are reported with the tick they were made in and
+	// Finish is called with the room checksum when the game shuts down, ok
+	// is false if no state on the stack has a checksum.
+	SessionSource interface {
+		EventSource
+		RecordEdit(tick uint64, e room.Edit)
+		Finish(checksum uint32, ok bool) error
+	}
+
+	// ChecksumState is implemented by states that can checksum their
+	// simulation, to verify replays.
+	ChecksumState interface {
+		Checksum() uint32
+	}
+)
+
+// ScriptedSource returns events added in advance, at the tick they were
+// added for. It drives the game without a platform.
+type ScriptedSource struct {
+	events []scriptedEvent
+}
+
+type scriptedEvent struct {
+	tick  uint64
+	event input.Event
+}
+
+func NewScriptedSource() *ScriptedSource {
+	return &ScriptedSource{}
+}
+
+// Add queues events to be returned at tick, after the events already
+// added for the same tick.
+func (s *ScriptedSource) Add(tick uint64, events ...input.Event) {
+	i := len(s.events)
+	for i > 0 && s.events[i-1].tick > tick {
+		i--
+	}
+
+	added := make([]scriptedEvent, len(events))
+	for j, ev := range events {
+		added[j] = scriptedEvent{tick, ev}
+	}
+	s.events = append(s.events[:i], append(added, s.events[i:]...)...)
+}
+
+// Len returns the number of events not yet returned.
+func (s *ScriptedSource) Len() int {
+	return len(s.events)
+}
+
+func (s *ScriptedSource) PollEvent(tick uint64) input.Event {
+	if len(s.events) == 0 || s.events[0].tick > tick {
+		return nil
+	}
+
+	ev := s.events[0].event
+	s.events = s.events[1:]
+	return ev
+}
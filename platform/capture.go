@@ -0,0 +1,226 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"log"
+	"os"
+	"time"
+
+	"github.com/andreas-jonsson/voxbox/platform/display"
+	"github.com/goxjs/gl"
+)
+
+const (
+	screenshotDir = "screenshots"
+	gifFrameSkip  = 3
+
+	// maxGIFFrames limits the memory used by a GIF recording, it is saved
+	// when the limit is reached. That is about 30 seconds at 60 fps.
+	maxGIFFrames = 600
+)
+
+// frameCapture implements the screenshot and recording part of Renderer.
+// Renderers must call present before swapping buffers.
+type frameCapture struct {
+	screenshotPending bool
+
+	recording  bool
+	format     display.RecordFormat
+	recordPath string
+	numFrames  int
+	lastFrame  time.Time
+	anim       gif.GIF
+}
+
+func captureFileName(ext string) string {
+	return time.Now().Format("2006-01-02-150405.000") + ext
+}
+
+// Screenshot reads back the current framebuffer.
+func (c *frameCapture) Screenshot() (*image.RGBA, error) {
+	var viewport [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, viewport[:])
+
+	w, h := int(viewport[2]), int(viewport[3])
+	if w <= 0 || h <= 0 {
+		return nil, errors.New("invalid viewport")
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	gl.ReadPixels(img.Pix, int(viewport[0]), int(viewport[1]), w, h, gl.RGBA, gl.UNSIGNED_BYTE)
+
+	// OpenGL has the origin in the lower left corner.
+	row := make([]byte, img.Stride)
+	for y := 0; y < h/2; y++ {
+		top := img.Pix[y*img.Stride : (y+1)*img.Stride]
+		bottom := img.Pix[(h-y-1)*img.Stride : (h-y)*img.Stride]
+		copy(row, top)
+		copy(top, bottom)
+		copy(bottom, row)
+	}
+
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img, nil
+}
+
+// SaveScreenshot saves the next presented frame as a PNG file in the
+// screenshots directory.
+func (c *frameCapture) SaveScreenshot() {
+	c.screenshotPending = true
+}
+
+// StartRecording captures every presented frame until StopRecording is
+// called. PNG recordings are written as a sequence of files in a new
+// directory, GIF recordings are kept in memory and written when stopped or
+// when they reach maxGIFFrames.
+func (c *frameCapture) StartRecording(format display.RecordFormat) error {
+	if c.recording {
+		return errors.New("already recording")
+	}
+
+	c.format = format
+	c.numFrames = 0
+	c.anim = gif.GIF{}
+
+	switch format {
+	case display.RecordPNG:
+		c.recordPath = CfgRootJoin(screenshotDir, captureFileName(""))
+		if err := os.MkdirAll(c.recordPath, 0755); err != nil {
+			return err
+		}
+	case display.RecordGIF:
+		c.recordPath = CfgRootJoin(screenshotDir, captureFileName(".gif"))
+		if err := os.MkdirAll(CfgRootJoin(screenshotDir), 0755); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid record format: %d", format)
+	}
+
+	c.recording = true
+	c.lastFrame = time.Now()
+	log.Println("Recording to:", c.recordPath)
+	return nil
+}
+
+// StopRecording ends the recording and returns the path it was written to.
+func (c *frameCapture) StopRecording() (string, error) {
+	if !c.recording {
+		return "", errors.New("not recording")
+	}
+	c.recording = false
+
+	if c.format == display.RecordGIF {
+		fp, err := os.Create(c.recordPath)
+		if err != nil {
+			return "", err
+		}
+		defer fp.Close()
+
+		err = gif.EncodeAll(fp, &c.anim)
+		c.anim = gif.GIF{}
+		if err != nil {
+			return "", err
+		}
+	}
+	return c.recordPath, nil
+}
+
+func (c *frameCapture) Recording() bool {
+	return c.recording
+}
+
+func (c *frameCapture) present() {
+	if c.screenshotPending {
+		c.screenshotPending = false
+		if file, err := c.saveScreenshot(); err != nil {
+			log.Println("Could not save screenshot:", err)
+		} else {
+			log.Println("Saved screenshot:", file)
+		}
+	}
+
+	if c.recording {
+		if err := c.recordFrame(); err != nil {
+			log.Println("Recording failed:", err)
+			c.StopRecording()
+		} else if c.format == display.RecordGIF && len(c.anim.Image) >= maxGIFFrames {
+			if file, err := c.StopRecording(); err != nil {
+				log.Println("Could not save recording:", err)
+			} else {
+				log.Println("Recording reached the frame limit, saved:", file)
+			}
+		}
+	}
+}
+
+func (c *frameCapture) saveScreenshot() (string, error) {
+	img, err := c.Screenshot()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(CfgRootJoin(screenshotDir), 0755); err != nil {
+		return "", err
+	}
+
+	file := CfgRootJoin(screenshotDir, captureFileName(".png"))
+	return file, writePNG(file, img)
+}
+
+func (c *frameCapture) recordFrame() error {
+	c.numFrames++
+
+	switch c.format {
+	case display.RecordPNG:
+		img, err := c.Screenshot()
+		if err != nil {
+			return err
+		}
+		return writePNG(CfgRootJoin(c.recordPath, fmt.Sprintf("frame%05d.png", c.numFrames)), img)
+	case display.RecordGIF:
+		if c.numFrames%gifFrameSkip != 0 {
+			return nil
+		}
+
+		img, err := c.Screenshot()
+		if err != nil {
+			return err
+		}
+
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.Draw(frame, frame.Bounds(), img, image.ZP, draw.Src)
+
+		// GIF delays are in 100ths of a second.
+		delay := int(time.Since(c.lastFrame) / (10 * time.Millisecond))
+		c.lastFrame = time.Now()
+
+		c.anim.Image = append(c.anim.Image, frame)
+		c.anim.Delay = append(c.anim.Delay, delay)
+	}
+	return nil
+}
+
+func writePNG(file string, img image.Image) error {
+	fp, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	return enc.Encode(fp, img)
+}
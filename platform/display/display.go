@@ -0,0 +1,86 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+// Package display holds the interface of the platform renderer and its
+// settings. It does not depend on a platform backend.
+package display
+
+import "image"
+
+type Renderer interface {
+	Clear()
+	Present()
+	Shutdown()
+	ToggleFullscreen()
+	SetWindowTitle(title string)
+
+	Screenshot() (*image.RGBA, error)
+	SaveScreenshot()
+	StartRecording(format RecordFormat) error
+	StopRecording() (string, error)
+	Recording() bool
+
+	SetRelativeMouse(enabled bool)
+	RelativeMouse() bool
+	SetMouseSensitivity(sensitivity float32, invertY bool)
+
+	SetPostEffects(effects PostEffects)
+	PostEffects() PostEffects
+	SetPostSettings(settings PostSettings)
+	PostSettings() PostSettings
+	PostProcess()
+}
+
+type RecordFormat int
+
+const (
+	RecordPNG RecordFormat = iota
+	RecordGIF
+)
+
+type PostEffects uint
+
+const (
+	PostFog PostEffects = 1 << iota
+	PostBloom
+	PostToneMapping
+	PostFXAA
+
+	PostNone PostEffects = 0
+	PostAll              = PostFog | PostBloom | PostToneMapping | PostFXAA
+)
+
+// Fog fades the scene towards Color between Start and End, in distance from
+// the camera. Near and Far must match the projection the scene is rendered with.
+type Fog struct {
+	Color      [3]float32
+	Start, End float32
+	Near, Far  float32
+}
+
+// ColorGrading is applied together with tone mapping, 1 is neutral for all values.
+type ColorGrading struct {
+	Exposure,
+	Contrast,
+	Saturation float32
+}
+
+type PostSettings struct {
+	Fog            Fog
+	BloomIntensity float32
+	Grading        ColorGrading
+}
+
+var DefaultPostSettings = PostSettings{
+	Fog: Fog{
+		Color: [3]float32{0.6, 0.6, 0.6},
+		Start: 200,
+		End:   600,
+		Near:  0.1,
+		Far:   10000,
+	},
+	BloomIntensity: 1,
+	Grading:        ColorGrading{1, 1, 1},
+}
@@ -5,47 +5,24 @@
 
 package platform
 
-const (
-	KeyUnknown = iota
-	KeyUp
-	KeyDown
-	KeyLeft
-	KeyRight
-	KeyEsc
-	KeyReturn
-)
-
-const (
-	MouseButtonDown = iota
-	MouseButtonUp
-	MouseWheel
-)
+// mouseLook holds the settings applied to the relative motion in
+// MouseMotionEvent, set by the renderer.
+var mouseLook = struct {
+	sensitivity float32
+	invertY     bool
+}{sensitivity: 1}
+
+// mouseLookDelta returns the relative motion scaled for mouse look.
+func mouseLookDelta(xrel, yrel int) (float32, float32) {
+	dx := float32(xrel) * mouseLook.sensitivity
+	dy := float32(yrel) * mouseLook.sensitivity
+	if mouseLook.invertY {
+		dy = -dy
+	}
+	return dx, dy
+}
 
 type MouseState struct {
 	X, Y    int
 	Buttons [3]bool
 }
-
-type (
-	Event     interface{}
-	QuitEvent struct{}
-
-	KeyUpEvent struct {
-		Rune rune
-		Key  int
-	}
-
-	KeyDownEvent KeyUpEvent
-
-	MouseWheelEvent struct {
-		X, Y int
-	}
-
-	MouseMotionEvent struct {
-		X, Y, XRel, YRel int
-	}
-
-	MouseButtonEvent struct {
-		X, Y, Button, Type int
-	}
-)
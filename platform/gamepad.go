@@ -0,0 +1,18 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package platform
+
+// applyDeadZone removes the dead zone dz from v and scales the rest of the
+// range back to -1..1.
+func applyDeadZone(v, dz float32) float32 {
+	switch {
+	case v > dz:
+		return (v - dz) / (1 - dz)
+	case v < -dz:
+		return (v + dz) / (1 - dz)
+	}
+	return 0
+}
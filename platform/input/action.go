@@ -0,0 +1,131 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package input
+
+import "sort"
+
+// ActionMap translates key and gamepad events to named actions and keeps
+// track of which actions are held down. An action can be bound to several
+// inputs but each input is bound to at most one action.
+type ActionMap struct {
+	inputs map[int]string
+	held   map[heldInput]bool
+}
+
+// heldInput is an input held down on a controller. Keys are held on
+// noController.
+type heldInput struct {
+	controller, key int
+}
+
+const noController = -1
+
+func NewActionMap() *ActionMap {
+	return &ActionMap{
+		inputs: make(map[int]string),
+		held:   make(map[heldInput]bool),
+	}
+}
+
+// Bind adds key, or gamepad input, to the inputs of action.
+func (m *ActionMap) Bind(action string, key int) {
+	if key != KeyUnknown {
+		m.inputs[key] = action
+	}
+}
+
+// Unbind removes all inputs of action.
+func (m *ActionMap) Unbind(action string) {
+	for k, a := range m.inputs {
+		if a == action {
+			delete(m.inputs, k)
+		}
+	}
+	for h := range m.held {
+		if _, ok := m.inputs[h.key]; !ok {
+			delete(m.held, h)
+		}
+	}
+}
+
+// Pressed returns true while an input bound to action is held down.
+func (m *ActionMap) Pressed(action string) bool {
+	for h := range m.held {
+		if m.inputs[h.key] == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Translate returns the action events caused by ev. Key repeats do not
+// generate actions. A removed controller releases the inputs held on it,
+// an action stays pressed while it is held on another controller.
+func (m *ActionMap) Translate(ev Event) []*ActionEvent {
+	var events []*ActionEvent
+	add := func(controller, key int, down bool) {
+		if ae := m.set(heldInput{controller, key}, down); ae != nil {
+			events = append(events, ae)
+		}
+	}
+
+	switch t := ev.(type) {
+	case *KeyDownEvent:
+		if !t.Repeat {
+			add(noController, t.Key, true)
+		}
+	case *KeyUpEvent:
+		add(noController, t.Key, false)
+	case *ControllerButtonEvent:
+		add(t.ID, PadA+t.Button, t.Pressed)
+	case *ControllerAxisEvent:
+		if inputs, ok := axisInputs[t.Axis]; ok {
+			add(t.ID, inputs[0], t.Value < -AxisPressLimit)
+			add(t.ID, inputs[1], t.Value > AxisPressLimit)
+		}
+	case *ControllerDeviceEvent:
+		if !t.Connected {
+			for _, key := range m.heldPadInputs(t.ID) {
+				add(t.ID, key, false)
+			}
+		}
+	}
+	return events
+}
+
+// heldPadInputs returns the gamepad inputs held down on controller, in
+// order so the released actions are reported in the same order every time.
+func (m *ActionMap) heldPadInputs(controller int) []int {
+	var keys []int
+	for h := range m.held {
+		if h.controller == controller {
+			keys = append(keys, h.key)
+		}
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// set updates the held state of an input and returns an action event if
+// the state of its action changed.
+func (m *ActionMap) set(h heldInput, down bool) *ActionEvent {
+	action, ok := m.inputs[h.key]
+	if !ok || m.held[h] == down {
+		return nil
+	}
+
+	pressed := m.Pressed(action)
+	if down {
+		m.held[h] = true
+	} else {
+		delete(m.held, h)
+	}
+
+	if pressed == m.Pressed(action) {
+		return nil
+	}
+	return &ActionEvent{Action: action, Pressed: !pressed}
+}
@@ -0,0 +1,312 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+// Package input holds the events sent by the platform and the actions they
+// are bound to. It does not depend on a platform backend, so the game can be
+// driven by recorded or scripted events.
+package input
+
+const (
+	KeyUnknown = iota
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyEsc
+	KeyReturn
+	KeySpace
+	KeyTab
+	KeyBackspace
+	KeyDelete
+	KeyInsert
+	KeyHome
+	KeyEnd
+	KeyPageUp
+	KeyPageDown
+	KeyLShift
+	KeyRShift
+	KeyLCtrl
+	KeyRCtrl
+	KeyLAlt
+	KeyRAlt
+	KeyCapsLock
+	KeyA
+	KeyB
+	KeyC
+	KeyD
+	KeyE
+	KeyF
+	KeyG
+	KeyH
+	KeyI
+	KeyJ
+	KeyK
+	KeyL
+	KeyM
+	KeyN
+	KeyO
+	KeyP
+	KeyQ
+	KeyR
+	KeyS
+	KeyT
+	KeyU
+	KeyV
+	KeyW
+	KeyX
+	KeyY
+	KeyZ
+	Key0
+	Key1
+	Key2
+	Key3
+	Key4
+	Key5
+	Key6
+	Key7
+	Key8
+	Key9
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeyMinus
+	KeyEquals
+	KeyLeftBracket
+	KeyRightBracket
+	KeyBackslash
+	KeySemicolon
+	KeyQuote
+	KeyComma
+	KeyPeriod
+	KeySlash
+	KeyBackquote
+	KeyKP0
+	KeyKP1
+	KeyKP2
+	KeyKP3
+	KeyKP4
+	KeyKP5
+	KeyKP6
+	KeyKP7
+	KeyKP8
+	KeyKP9
+	KeyKPEnter
+	KeyKPPlus
+	KeyKPMinus
+	KeyKPMultiply
+	KeyKPDivide
+	KeyKPPeriod
+)
+
+var keyNames = map[int]string{
+	KeyUp:           "Up",
+	KeyDown:         "Down",
+	KeyLeft:         "Left",
+	KeyRight:        "Right",
+	KeyEsc:          "Escape",
+	KeyReturn:       "Return",
+	KeySpace:        "Space",
+	KeyTab:          "Tab",
+	KeyBackspace:    "Backspace",
+	KeyDelete:       "Delete",
+	KeyInsert:       "Insert",
+	KeyHome:         "Home",
+	KeyEnd:          "End",
+	KeyPageUp:       "PageUp",
+	KeyPageDown:     "PageDown",
+	KeyLShift:       "LeftShift",
+	KeyRShift:       "RightShift",
+	KeyLCtrl:        "LeftCtrl",
+	KeyRCtrl:        "RightCtrl",
+	KeyLAlt:         "LeftAlt",
+	KeyRAlt:         "RightAlt",
+	KeyCapsLock:     "CapsLock",
+	KeyA:            "A",
+	KeyB:            "B",
+	KeyC:            "C",
+	KeyD:            "D",
+	KeyE:            "E",
+	KeyF:            "F",
+	KeyG:            "G",
+	KeyH:            "H",
+	KeyI:            "I",
+	KeyJ:            "J",
+	KeyK:            "K",
+	KeyL:            "L",
+	KeyM:            "M",
+	KeyN:            "N",
+	KeyO:            "O",
+	KeyP:            "P",
+	KeyQ:            "Q",
+	KeyR:            "R",
+	KeyS:            "S",
+	KeyT:            "T",
+	KeyU:            "U",
+	KeyV:            "V",
+	KeyW:            "W",
+	KeyX:            "X",
+	KeyY:            "Y",
+	KeyZ:            "Z",
+	Key0:            "0",
+	Key1:            "1",
+	Key2:            "2",
+	Key3:            "3",
+	Key4:            "4",
+	Key5:            "5",
+	Key6:            "6",
+	Key7:            "7",
+	Key8:            "8",
+	Key9:            "9",
+	KeyF1:           "F1",
+	KeyF2:           "F2",
+	KeyF3:           "F3",
+	KeyF4:           "F4",
+	KeyF5:           "F5",
+	KeyF6:           "F6",
+	KeyF7:           "F7",
+	KeyF8:           "F8",
+	KeyF9:           "F9",
+	KeyF10:          "F10",
+	KeyF11:          "F11",
+	KeyF12:          "F12",
+	KeyMinus:        "-",
+	KeyEquals:       "=",
+	KeyLeftBracket:  "[",
+	KeyRightBracket: "]",
+	KeyBackslash:    "\\",
+	KeySemicolon:    ";",
+	KeyQuote:        "'",
+	KeyComma:        ",",
+	KeyPeriod:       ".",
+	KeySlash:        "/",
+	KeyBackquote:    "`",
+	KeyKP0:          "Keypad0",
+	KeyKP1:          "Keypad1",
+	KeyKP2:          "Keypad2",
+	KeyKP3:          "Keypad3",
+	KeyKP4:          "Keypad4",
+	KeyKP5:          "Keypad5",
+	KeyKP6:          "Keypad6",
+	KeyKP7:          "Keypad7",
+	KeyKP8:          "Keypad8",
+	KeyKP9:          "Keypad9",
+	KeyKPEnter:      "KeypadEnter",
+	KeyKPPlus:       "Keypad+",
+	KeyKPMinus:      "Keypad-",
+	KeyKPMultiply:   "Keypad*",
+	KeyKPDivide:     "Keypad/",
+	KeyKPPeriod:     "Keypad.",
+}
+
+// KeyName returns a readable name for a key or gamepad input, used when
+// saving bindings.
+func KeyName(key int) string {
+	if name, ok := keyNames[key]; ok {
+		return name
+	}
+	if name, ok := padNames[key]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// KeyFromName is the inverse of KeyName.
+func KeyFromName(name string) int {
+	for _, names := range []map[int]string{keyNames, padNames} {
+		for key, n := range names {
+			if n == name {
+				return key
+			}
+		}
+	}
+	return KeyUnknown
+}
+
+const (
+	MouseButtonDown = iota
+	MouseButtonUp
+	MouseWheel
+)
+
+// Mouse buttons, touches are reported as the left button.
+const (
+	MouseLeft = iota + 1
+	MouseMiddle
+	MouseRight
+)
+
+type (
+	Event     interface{}
+	QuitEvent struct{}
+
+	// WindowResizeEvent is sent when the drawable size changes. The size is
+	// in pixels, which is larger than the window size on high-DPI displays.
+	// The viewport is updated before the event is sent.
+	WindowResizeEvent struct {
+		Width, Height int
+	}
+
+	KeyUpEvent struct {
+		Key int
+	}
+
+	KeyDownEvent struct {
+		Key    int
+		Repeat bool
+	}
+
+	// TextInputEvent holds typed text, key events are sent separately.
+	TextInputEvent struct {
+		Text string
+	}
+
+	ControllerDeviceEvent struct {
+		ID        int
+		Connected bool
+	}
+
+	ControllerButtonEvent struct {
+		ID, Button int
+		Pressed    bool
+	}
+
+	// ControllerAxisEvent is sent when the axis value changes. Value is in
+	// the range -1..1 for sticks and 0..1 for triggers, with the dead zone
+	// removed.
+	ControllerAxisEvent struct {
+		ID, Axis int
+		Value    float32
+	}
+
+	// ActionEvent is sent when an action is pressed or released.
+	ActionEvent struct {
+		Action  string
+		Pressed bool
+	}
+
+	MouseWheelEvent struct {
+		X, Y int
+	}
+
+	// MouseMotionEvent holds the mouse position and relative motion. DX and
+	// DY is the relative motion scaled by the mouse sensitivity, for mouse look.
+	MouseMotionEvent struct {
+		X, Y, XRel, YRel int
+		DX, DY           float32
+	}
+
+	MouseButtonEvent struct {
+		X, Y, Button, Type int
+	}
+)
@@ -0,0 +1,115 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package input
+
+const (
+	ButtonA = iota
+	ButtonB
+	ButtonX
+	ButtonY
+	ButtonBack
+	ButtonGuide
+	ButtonStart
+	ButtonLeftStick
+	ButtonRightStick
+	ButtonLeftShoulder
+	ButtonRightShoulder
+	ButtonDPadUp
+	ButtonDPadDown
+	ButtonDPadLeft
+	ButtonDPadRight
+)
+
+const (
+	AxisLeftX = iota
+	AxisLeftY
+	AxisRightX
+	AxisRightY
+	AxisTriggerLeft
+	AxisTriggerRight
+)
+
+// Gamepad inputs share the key space so they can be bound to actions.
+// Buttons are offset from PadA in the same order as the button constants.
+// Stick directions and triggers are pressed when moved past AxisPressLimit.
+const (
+	PadA = iota + 1024
+	PadB
+	PadX
+	PadY
+	PadBack
+	PadGuide
+	PadStart
+	PadLeftStick
+	PadRightStick
+	PadLeftShoulder
+	PadRightShoulder
+	PadDPadUp
+	PadDPadDown
+	PadDPadLeft
+	PadDPadRight
+	PadLeftStickLeft
+	PadLeftStickRight
+	PadLeftStickUp
+	PadLeftStickDown
+	PadRightStickLeft
+	PadRightStickRight
+	PadRightStickUp
+	PadRightStickDown
+	PadLeftTrigger
+	PadRightTrigger
+)
+
+const AxisPressLimit = 0.5
+
+// DefaultDeadZone is the default part of the axis range around the center
+// that is reported as zero.
+const DefaultDeadZone = 0.2
+
+var padNames = map[int]string{
+	PadA:               "PadA",
+	PadB:               "PadB",
+	PadX:               "PadX",
+	PadY:               "PadY",
+	PadBack:            "PadBack",
+	PadGuide:           "PadGuide",
+	PadStart:           "PadStart",
+	PadLeftStick:       "PadLeftStick",
+	PadRightStick:      "PadRightStick",
+	PadLeftShoulder:    "PadLeftShoulder",
+	PadRightShoulder:   "PadRightShoulder",
+	PadDPadUp:          "PadUp",
+	PadDPadDown:        "PadDown",
+	PadDPadLeft:        "PadLeft",
+	PadDPadRight:       "PadRight",
+	PadLeftStickLeft:   "PadLeftStickLeft",
+	PadLeftStickRight:  "PadLeftStickRight",
+	PadLeftStickUp:     "PadLeftStickUp",
+	PadLeftStickDown:   "PadLeftStickDown",
+	PadRightStickLeft:  "PadRightStickLeft",
+	PadRightStickRight: "PadRightStickRight",
+	PadRightStickUp:    "PadRightStickUp",
+	PadRightStickDown:  "PadRightStickDown",
+	PadLeftTrigger:     "PadLeftTrigger",
+	PadRightTrigger:    "PadRightTrigger",
+}
+
+// axisInputs holds the inputs pressed by moving an axis in the negative
+// and positive direction.
+var axisInputs = map[int][2]int{
+	AxisLeftX:        {PadLeftStickLeft, PadLeftStickRight},
+	AxisLeftY:        {PadLeftStickUp, PadLeftStickDown},
+	AxisRightX:       {PadRightStickLeft, PadRightStickRight},
+	AxisRightY:       {PadRightStickUp, PadRightStickDown},
+	AxisTriggerLeft:  {KeyUnknown, PadLeftTrigger},
+	AxisTriggerRight: {KeyUnknown, PadRightTrigger},
+}
+
+// IsPadInput returns true if key is a gamepad input.
+func IsPadInput(key int) bool {
+	_, ok := padNames[key]
+	return ok
+}
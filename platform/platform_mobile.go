@@ -8,15 +8,120 @@
 package platform
 
 import (
+	"github.com/andreas-jonsson/voxbox/platform/input"
+	"github.com/goxjs/gl"
+	"golang.org/x/mobile/event/key"
 	"golang.org/x/mobile/event/size"
 	"golang.org/x/mobile/event/touch"
 )
 
 const maxEvents = 128
 
+var keyMapping = map[key.Code]int{
+	key.CodeUpArrow:            input.KeyUp,
+	key.CodeDownArrow:          input.KeyDown,
+	key.CodeLeftArrow:          input.KeyLeft,
+	key.CodeRightArrow:         input.KeyRight,
+	key.CodeEscape:             input.KeyEsc,
+	key.CodeReturnEnter:        input.KeyReturn,
+	key.CodeSpacebar:           input.KeySpace,
+	key.CodeTab:                input.KeyTab,
+	key.CodeDeleteBackspace:    input.KeyBackspace,
+	key.CodeDeleteForward:      input.KeyDelete,
+	key.CodeInsert:             input.KeyInsert,
+	key.CodeHome:               input.KeyHome,
+	key.CodeEnd:                input.KeyEnd,
+	key.CodePageUp:             input.KeyPageUp,
+	key.CodePageDown:           input.KeyPageDown,
+	key.CodeLeftShift:          input.KeyLShift,
+	key.CodeRightShift:         input.KeyRShift,
+	key.CodeLeftControl:        input.KeyLCtrl,
+	key.CodeRightControl:       input.KeyRCtrl,
+	key.CodeLeftAlt:            input.KeyLAlt,
+	key.CodeRightAlt:           input.KeyRAlt,
+	key.CodeCapsLock:           input.KeyCapsLock,
+	key.CodeA:                  input.KeyA,
+	key.CodeB:                  input.KeyB,
+	key.CodeC:                  input.KeyC,
+	key.CodeD:                  input.KeyD,
+	key.CodeE:                  input.KeyE,
+	key.CodeF:                  input.KeyF,
+	key.CodeG:                  input.KeyG,
+	key.CodeH:                  input.KeyH,
+	key.CodeI:                  input.KeyI,
+	key.CodeJ:                  input.KeyJ,
+	key.CodeK:                  input.KeyK,
+	key.CodeL:                  input.KeyL,
+	key.CodeM:                  input.KeyM,
+	key.CodeN:                  input.KeyN,
+	key.CodeO:                  input.KeyO,
+	key.CodeP:                  input.KeyP,
+	key.CodeQ:                  input.KeyQ,
+	key.CodeR:                  input.KeyR,
+	key.CodeS:                  input.KeyS,
+	key.CodeT:                  input.KeyT,
+	key.CodeU:                  input.KeyU,
+	key.CodeV:                  input.KeyV,
+	key.CodeW:                  input.KeyW,
+	key.CodeX:                  input.KeyX,
+	key.CodeY:                  input.KeyY,
+	key.CodeZ:                  input.KeyZ,
+	key.Code0:                  input.Key0,
+	key.Code1:                  input.Key1,
+	key.Code2:                  input.Key2,
+	key.Code3:                  input.Key3,
+	key.Code4:                  input.Key4,
+	key.Code5:                  input.Key5,
+	key.Code6:                  input.Key6,
+	key.Code7:                  input.Key7,
+	key.Code8:                  input.Key8,
+	key.Code9:                  input.Key9,
+	key.CodeF1:                 input.KeyF1,
+	key.CodeF2:                 input.KeyF2,
+	key.CodeF3:                 input.KeyF3,
+	key.CodeF4:                 input.KeyF4,
+	key.CodeF5:                 input.KeyF5,
+	key.CodeF6:                 input.KeyF6,
+	key.CodeF7:                 input.KeyF7,
+	key.CodeF8:                 input.KeyF8,
+	key.CodeF9:                 input.KeyF9,
+	key.CodeF10:                input.KeyF10,
+	key.CodeF11:                input.KeyF11,
+	key.CodeF12:                input.KeyF12,
+	key.CodeHyphenMinus:        input.KeyMinus,
+	key.CodeEqualSign:          input.KeyEquals,
+	key.CodeLeftSquareBracket:  input.KeyLeftBracket,
+	key.CodeRightSquareBracket: input.KeyRightBracket,
+	key.CodeBackslash:          input.KeyBackslash,
+	key.CodeSemicolon:          input.KeySemicolon,
+	key.CodeApostrophe:         input.KeyQuote,
+	key.CodeComma:              input.KeyComma,
+	key.CodeFullStop:           input.KeyPeriod,
+	key.CodeSlash:              input.KeySlash,
+	key.CodeGraveAccent:        input.KeyBackquote,
+	key.CodeKeypad0:            input.KeyKP0,
+	key.CodeKeypad1:            input.KeyKP1,
+	key.CodeKeypad2:            input.KeyKP2,
+	key.CodeKeypad3:            input.KeyKP3,
+	key.CodeKeypad4:            input.KeyKP4,
+	key.CodeKeypad5:            input.KeyKP5,
+	key.CodeKeypad6:            input.KeyKP6,
+	key.CodeKeypad7:            input.KeyKP7,
+	key.CodeKeypad8:            input.KeyKP8,
+	key.CodeKeypad9:            input.KeyKP9,
+	key.CodeKeypadEnter:        input.KeyKPEnter,
+	key.CodeKeypadPlusSign:     input.KeyKPPlus,
+	key.CodeKeypadHyphenMinus:  input.KeyKPMinus,
+	key.CodeKeypadAsterisk:     input.KeyKPMultiply,
+	key.CodeKeypadSlash:        input.KeyKPDivide,
+	key.CodeKeypadFullStop:     input.KeyKPPeriod,
+}
+
 var (
 	InputEventChan = make(chan interface{}, maxEvents)
-	sizeEvent      size.Event
+
+	// pendingEvent is returned by the next call to PollEvent.
+	pendingEvent input.Event
 )
 
 func Init() error {
@@ -31,27 +136,56 @@ func Mouse() MouseState {
 	return MouseState{}
 }
 
-func PollEvent() Event {
+// mobileEventSource polls the events of the mobile app.
+type mobileEventSource struct{}
+
+// NewEventSource returns the event source of the platform, for the game.
+// There are no controllers on mobile, the dead zone is not used.
+func NewEventSource(deadZone float32) mobileEventSource {
+	return mobileEventSource{}
+}
+
+func (mobileEventSource) PollEvent(tick uint64) input.Event {
+	return PollEvent()
+}
+
+func PollEvent() input.Event {
+	if ev := pendingEvent; ev != nil {
+		pendingEvent = nil
+		return ev
+	}
+
 	select {
 	case ev, ok := <-InputEventChan:
 		if ok {
 			switch e := ev.(type) {
 			case size.Event:
-				sizeEvent = e
+				gl.Viewport(0, 0, e.WidthPx, e.HeightPx)
+				return &input.WindowResizeEvent{Width: e.WidthPx, Height: e.HeightPx}
+			case key.Event:
+				switch e.Direction {
+				case key.DirPress, key.DirNone:
+					if e.Rune > 0 {
+						pendingEvent = &input.TextInputEvent{Text: string(e.Rune)}
+					}
+					return &input.KeyDownEvent{Key: keyMapping[e.Code]}
+				case key.DirRelease:
+					return &input.KeyUpEvent{Key: keyMapping[e.Code]}
+				}
 			case touch.Event:
-				ws := 320 / float32(sizeEvent.WidthPx)
-				hs := 200 / float32(sizeEvent.HeightPx)
+				// Touches are in surface pixels, same as the viewport.
+				x, y := int(e.X), int(e.Y)
 
 				if e.Type == touch.TypeBegin {
-					return &MouseButtonEvent{X: int(e.X * ws), Y: int(e.Y * hs), Button: 0, Type: MouseButtonDown}
+					return &input.MouseButtonEvent{X: x, Y: y, Button: input.MouseLeft, Type: input.MouseButtonDown}
 				} else if e.Type == touch.TypeEnd {
-					return &MouseButtonEvent{X: int(e.X * ws), Y: int(e.Y * hs), Button: 0, Type: MouseButtonUp}
+					return &input.MouseButtonEvent{X: x, Y: y, Button: input.MouseLeft, Type: input.MouseButtonUp}
 				} else {
-					return &MouseMotionEvent{X: int(e.X * ws), Y: int(e.Y * hs)}
+					return &input.MouseMotionEvent{X: x, Y: y}
 				}
 			}
 		} else {
-			return QuitEvent{}
+			return input.QuitEvent{}
 		}
 	default:
 	}
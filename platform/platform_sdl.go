@@ -8,27 +8,166 @@
 package platform
 
 import (
+	"bytes"
+	"log"
 	"os"
 	"os/user"
 	"path"
 	"runtime"
 
+	"github.com/andreas-jonsson/voxbox/platform/input"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
 var keyMapping = map[sdl.Keycode]int{
-	sdl.K_UP:     KeyUp,
-	sdl.K_DOWN:   KeyDown,
-	sdl.K_LEFT:   KeyLeft,
-	sdl.K_RIGHT:  KeyRight,
-	sdl.K_ESCAPE: KeyEsc,
-	sdl.K_RETURN: KeyReturn,
+	sdl.K_UP:           input.KeyUp,
+	sdl.K_DOWN:         input.KeyDown,
+	sdl.K_LEFT:         input.KeyLeft,
+	sdl.K_RIGHT:        input.KeyRight,
+	sdl.K_ESCAPE:       input.KeyEsc,
+	sdl.K_RETURN:       input.KeyReturn,
+	sdl.K_SPACE:        input.KeySpace,
+	sdl.K_TAB:          input.KeyTab,
+	sdl.K_BACKSPACE:    input.KeyBackspace,
+	sdl.K_DELETE:       input.KeyDelete,
+	sdl.K_INSERT:       input.KeyInsert,
+	sdl.K_HOME:         input.KeyHome,
+	sdl.K_END:          input.KeyEnd,
+	sdl.K_PAGEUP:       input.KeyPageUp,
+	sdl.K_PAGEDOWN:     input.KeyPageDown,
+	sdl.K_LSHIFT:       input.KeyLShift,
+	sdl.K_RSHIFT:       input.KeyRShift,
+	sdl.K_LCTRL:        input.KeyLCtrl,
+	sdl.K_RCTRL:        input.KeyRCtrl,
+	sdl.K_LALT:         input.KeyLAlt,
+	sdl.K_RALT:         input.KeyRAlt,
+	sdl.K_CAPSLOCK:     input.KeyCapsLock,
+	sdl.K_a:            input.KeyA,
+	sdl.K_b:            input.KeyB,
+	sdl.K_c:            input.KeyC,
+	sdl.K_d:            input.KeyD,
+	sdl.K_e:            input.KeyE,
+	sdl.K_f:            input.KeyF,
+	sdl.K_g:            input.KeyG,
+	sdl.K_h:            input.KeyH,
+	sdl.K_i:            input.KeyI,
+	sdl.K_j:            input.KeyJ,
+	sdl.K_k:            input.KeyK,
+	sdl.K_l:            input.KeyL,
+	sdl.K_m:            input.KeyM,
+	sdl.K_n:            input.KeyN,
+	sdl.K_o:            input.KeyO,
+	sdl.K_p:            input.KeyP,
+	sdl.K_q:            input.KeyQ,
+	sdl.K_r:            input.KeyR,
+	sdl.K_s:            input.KeyS,
+	sdl.K_t:            input.KeyT,
+	sdl.K_u:            input.KeyU,
+	sdl.K_v:            input.KeyV,
+	sdl.K_w:            input.KeyW,
+	sdl.K_x:            input.KeyX,
+	sdl.K_y:            input.KeyY,
+	sdl.K_z:            input.KeyZ,
+	sdl.K_0:            input.Key0,
+	sdl.K_1:            input.Key1,
+	sdl.K_2:            input.Key2,
+	sdl.K_3:            input.Key3,
+	sdl.K_4:            input.Key4,
+	sdl.K_5:            input.Key5,
+	sdl.K_6:            input.Key6,
+	sdl.K_7:            input.Key7,
+	sdl.K_8:            input.Key8,
+	sdl.K_9:            input.Key9,
+	sdl.K_F1:           input.KeyF1,
+	sdl.K_F2:           input.KeyF2,
+	sdl.K_F3:           input.KeyF3,
+	sdl.K_F4:           input.KeyF4,
+	sdl.K_F5:           input.KeyF5,
+	sdl.K_F6:           input.KeyF6,
+	sdl.K_F7:           input.KeyF7,
+	sdl.K_F8:           input.KeyF8,
+	sdl.K_F9:           input.KeyF9,
+	sdl.K_F10:          input.KeyF10,
+	sdl.K_F11:          input.KeyF11,
+	sdl.K_F12:          input.KeyF12,
+	sdl.K_MINUS:        input.KeyMinus,
+	sdl.K_EQUALS:       input.KeyEquals,
+	sdl.K_LEFTBRACKET:  input.KeyLeftBracket,
+	sdl.K_RIGHTBRACKET: input.KeyRightBracket,
+	sdl.K_BACKSLASH:    input.KeyBackslash,
+	sdl.K_SEMICOLON:    input.KeySemicolon,
+	sdl.K_QUOTE:        input.KeyQuote,
+	sdl.K_COMMA:        input.KeyComma,
+	sdl.K_PERIOD:       input.KeyPeriod,
+	sdl.K_SLASH:        input.KeySlash,
+	sdl.K_BACKQUOTE:    input.KeyBackquote,
+	sdl.K_KP_0:         input.KeyKP0,
+	sdl.K_KP_1:         input.KeyKP1,
+	sdl.K_KP_2:         input.KeyKP2,
+	sdl.K_KP_3:         input.KeyKP3,
+	sdl.K_KP_4:         input.KeyKP4,
+	sdl.K_KP_5:         input.KeyKP5,
+	sdl.K_KP_6:         input.KeyKP6,
+	sdl.K_KP_7:         input.KeyKP7,
+	sdl.K_KP_8:         input.KeyKP8,
+	sdl.K_KP_9:         input.KeyKP9,
+	sdl.K_KP_ENTER:     input.KeyKPEnter,
+	sdl.K_KP_PLUS:      input.KeyKPPlus,
+	sdl.K_KP_MINUS:     input.KeyKPMinus,
+	sdl.K_KP_MULTIPLY:  input.KeyKPMultiply,
+	sdl.K_KP_DIVIDE:    input.KeyKPDivide,
+	sdl.K_KP_PERIOD:    input.KeyKPPeriod,
+}
+
+var buttonMapping = map[uint8]int{
+	sdl.CONTROLLER_BUTTON_A:             input.ButtonA,
+	sdl.CONTROLLER_BUTTON_B:             input.ButtonB,
+	sdl.CONTROLLER_BUTTON_X:             input.ButtonX,
+	sdl.CONTROLLER_BUTTON_Y:             input.ButtonY,
+	sdl.CONTROLLER_BUTTON_BACK:          input.ButtonBack,
+	sdl.CONTROLLER_BUTTON_GUIDE:         input.ButtonGuide,
+	sdl.CONTROLLER_BUTTON_START:         input.ButtonStart,
+	sdl.CONTROLLER_BUTTON_LEFTSTICK:     input.ButtonLeftStick,
+	sdl.CONTROLLER_BUTTON_RIGHTSTICK:    input.ButtonRightStick,
+	sdl.CONTROLLER_BUTTON_LEFTSHOULDER:  input.ButtonLeftShoulder,
+	sdl.CONTROLLER_BUTTON_RIGHTSHOULDER: input.ButtonRightShoulder,
+	sdl.CONTROLLER_BUTTON_DPAD_UP:       input.ButtonDPadUp,
+	sdl.CONTROLLER_BUTTON_DPAD_DOWN:     input.ButtonDPadDown,
+	sdl.CONTROLLER_BUTTON_DPAD_LEFT:     input.ButtonDPadLeft,
+	sdl.CONTROLLER_BUTTON_DPAD_RIGHT:    input.ButtonDPadRight,
+}
+
+var axisMapping = map[uint8]int{
+	sdl.CONTROLLER_AXIS_LEFTX:        input.AxisLeftX,
+	sdl.CONTROLLER_AXIS_LEFTY:        input.AxisLeftY,
+	sdl.CONTROLLER_AXIS_RIGHTX:       input.AxisRightX,
+	sdl.CONTROLLER_AXIS_RIGHTY:       input.AxisRightY,
+	sdl.CONTROLLER_AXIS_TRIGGERLEFT:  input.AxisTriggerLeft,
+	sdl.CONTROLLER_AXIS_TRIGGERRIGHT: input.AxisTriggerRight,
+}
+
+type axisID struct {
+	controller sdl.JoystickID
+	axis       int
+}
+
+var (
+	controllers = make(map[sdl.JoystickID]*sdl.GameController)
+	axisValues  = make(map[axisID]float32)
+)
+
+// pixelScale is the drawable size divided by the window size. It is larger
+// than one on high-DPI displays and converts mouse coordinates to pixels.
+var pixelScale = struct{ x, y float32 }{1, 1}
+
+func toPixels(x, y int) (int, int) {
+	return int(float32(x) * pixelScale.x), int(float32(y) * pixelScale.y)
 }
 
 var mouseMapping = map[int]int{
-	sdl.MOUSEBUTTONDOWN: MouseButtonDown,
-	sdl.MOUSEBUTTONUP:   MouseButtonUp,
-	sdl.MOUSEWHEEL:      MouseWheel,
+	sdl.MOUSEBUTTONDOWN: input.MouseButtonDown,
+	sdl.MOUSEBUTTONUP:   input.MouseButtonUp,
+	sdl.MOUSEWHEEL:      input.MouseWheel,
 }
 
 func init() {
@@ -51,10 +190,16 @@ func Init() error {
 	if err := sdl.Init(sdl.INIT_VIDEO | sdl.INIT_AUDIO | sdl.INIT_GAMECONTROLLER); err != nil {
 		return err
 	}
+
+	sdl.StartTextInput()
 	return nil
 }
 
 func Shutdown() {
+	for id, ctrl := range controllers {
+		ctrl.Close()
+		delete(controllers, id)
+	}
 	sdl.Quit()
 }
 
@@ -70,65 +215,154 @@ func Mouse() MouseState {
 	middle := (buttons & sdl.ButtonMMask()) != 0
 	right := (buttons & sdl.ButtonRMask()) != 0
 
-	return MouseState{X: x, Y: y, Buttons: [3]bool{left, middle, right}}
+	px, py := toPixels(x, y)
+	return MouseState{X: px, Y: py, Buttons: [3]bool{left, middle, right}}
+}
+
+// sdlEventSource polls the events of SDL.
+type sdlEventSource struct {
+	deadZone float32
+}
+
+// NewEventSource returns the event source of the platform, for the game.
+// Controller axis values within deadZone of the center are reported as zero.
+func NewEventSource(deadZone float32) sdlEventSource {
+	return sdlEventSource{deadZone}
 }
 
-func PollEvent() Event {
-	event := sdl.PollEvent()
-	if event == nil {
-		return nil
+func (s sdlEventSource) PollEvent(tick uint64) input.Event {
+	return pollEvent(s.deadZone)
+}
+
+// PollEvent returns the next event, with the default controller dead zone.
+func PollEvent() input.Event {
+	return pollEvent(input.DefaultDeadZone)
+}
+
+func pollEvent(deadZone float32) input.Event {
+	for {
+		event := sdl.PollEvent()
+		if event == nil {
+			return nil
+		}
+
+		// Skip events that are not translated.
+		if ev := translateEvent(event, deadZone); ev != nil {
+			return ev
+		}
 	}
+}
 
+func translateEvent(event sdl.Event, deadZone float32) input.Event {
 	switch t := event.(type) {
 	case *sdl.QuitEvent:
-		return &QuitEvent{}
+		return &input.QuitEvent{}
 	case *sdl.KeyUpEvent:
-		ev := &KeyUpEvent{}
-		if key, ok := keyMapping[t.Keysym.Sym]; ok {
-			ev.Key = key
-			ev.Rune = rune(t.Keysym.Unicode)
-		} else {
-			ev.Key = KeyUnknown
-		}
-		return ev
+		return &input.KeyUpEvent{Key: keyMapping[t.Keysym.Sym]}
 	case *sdl.KeyDownEvent:
-		ev := &KeyDownEvent{}
-		if key, ok := keyMapping[t.Keysym.Sym]; ok {
-			ev.Key = key
-			ev.Rune = rune(t.Keysym.Unicode)
-		} else {
-			ev.Key = KeyUnknown
+		return &input.KeyDownEvent{Key: keyMapping[t.Keysym.Sym], Repeat: t.Repeat != 0}
+	case *sdl.TextInputEvent:
+		n := bytes.IndexByte(t.Text[:], 0)
+		if n < 0 {
+			n = len(t.Text)
 		}
-		return ev
+		return &input.TextInputEvent{Text: string(t.Text[:n])}
+	case *sdl.WindowEvent:
+		if t.Event != sdl.WINDOWEVENT_SIZE_CHANGED {
+			break
+		}
+
+		window, err := sdl.GetWindowFromID(t.WindowID)
+		if err != nil {
+			log.Println("Could not resize viewport:", err)
+			break
+		}
+
+		size := resizeViewport(window)
+		return &input.WindowResizeEvent{Width: size.X, Height: size.Y}
 	case *sdl.MouseButtonEvent:
-		ev := &MouseButtonEvent{
+		x, y := toPixels(int(t.X), int(t.Y))
+		ev := &input.MouseButtonEvent{
 			Button: int(t.Button),
-			X:      int(t.X),
-			Y:      int(t.Y),
+			X:      x,
+			Y:      y,
 		}
 
 		switch t.Type {
 		case sdl.MOUSEBUTTONDOWN:
-			ev.Type = MouseButtonDown
+			ev.Type = input.MouseButtonDown
 		case sdl.MOUSEBUTTONUP:
-			ev.Type = MouseButtonUp
+			ev.Type = input.MouseButtonUp
 		case sdl.MOUSEWHEEL:
-			ev.Type = MouseWheel
+			ev.Type = input.MouseWheel
 		}
 		return ev
 	case *sdl.MouseMotionEvent:
-		return &MouseMotionEvent{
-			X:    int(t.X),
-			Y:    int(t.Y),
+		x, y := toPixels(int(t.X), int(t.Y))
+		ev := &input.MouseMotionEvent{
+			X:    x,
+			Y:    y,
 			XRel: int(t.XRel),
 			YRel: int(t.YRel),
 		}
+		ev.DX, ev.DY = mouseLookDelta(ev.XRel, ev.YRel)
+		return ev
 	case *sdl.MouseWheelEvent:
-		return &MouseWheelEvent{
+		return &input.MouseWheelEvent{
 			X: int(t.X),
 			Y: int(t.Y),
 		}
+	case *sdl.ControllerDeviceEvent:
+		return controllerDeviceEvent(t)
+	case *sdl.ControllerButtonEvent:
+		if button, ok := buttonMapping[t.Button]; ok {
+			return &input.ControllerButtonEvent{ID: int(t.Which), Button: button, Pressed: t.State == sdl.PRESSED}
+		}
+	case *sdl.ControllerAxisEvent:
+		axis, ok := axisMapping[t.Axis]
+		if !ok {
+			break
+		}
+
+		// Only changes outside the dead zone are reported.
+		id := axisID{t.Which, axis}
+		v := applyDeadZone(float32(t.Value)/32767, deadZone)
+		if v != axisValues[id] {
+			axisValues[id] = v
+			return &input.ControllerAxisEvent{ID: int(t.Which), Axis: axis, Value: v}
+		}
 	}
 
 	return nil
 }
+
+// controllerDeviceEvent opens added controllers and closes removed ones.
+// The event of an added controller holds the device index, all other
+// controller events use the instance id.
+func controllerDeviceEvent(t *sdl.ControllerDeviceEvent) input.Event {
+	switch t.Type {
+	case sdl.CONTROLLERDEVICEADDED:
+		ctrl := sdl.GameControllerOpen(int(t.Which))
+		if ctrl == nil {
+			log.Println("Could not open controller:", sdl.GetError())
+			return nil
+		}
+
+		id := ctrl.GetJoystick().InstanceID()
+		controllers[id] = ctrl
+		log.Println("Controller connected:", ctrl.Name())
+		return &input.ControllerDeviceEvent{ID: int(id), Connected: true}
+	case sdl.CONTROLLERDEVICEREMOVED:
+		if ctrl, ok := controllers[t.Which]; ok {
+			ctrl.Close()
+			delete(controllers, t.Which)
+			for id := range axisValues {
+				if id.controller == t.Which {
+					delete(axisValues, id)
+				}
+			}
+			return &input.ControllerDeviceEvent{ID: int(t.Which)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,525 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package platform
+
+import (
+	"errors"
+	"image"
+	"log"
+	"strings"
+
+	"github.com/andreas-jonsson/voxbox/platform/display"
+	"github.com/goxjs/gl"
+	"github.com/goxjs/gl/glutil"
+)
+
+// depthAttachment selects how the depth of a render target is stored.
+type depthAttachment int
+
+const (
+	noDepth depthAttachment = iota
+
+	// depthBuffer is a renderbuffer that can not be sampled, for when
+	// depth textures are not supported.
+	depthBuffer
+	depthTexture
+)
+
+type renderTarget struct {
+	framebufferID gl.Framebuffer
+	colorID,
+	depthID gl.Texture
+	depthBufferID gl.Renderbuffer
+}
+
+func (t *renderTarget) create(w, h int, depth depthAttachment) error {
+	t.colorID = createTargetTexture(w, h, gl.RGBA, gl.UNSIGNED_BYTE)
+	switch depth {
+	case depthTexture:
+		t.depthID = createTargetTexture(w, h, gl.DEPTH_COMPONENT, gl.UNSIGNED_INT)
+	case depthBuffer:
+		t.depthBufferID = gl.CreateRenderbuffer()
+		gl.BindRenderbuffer(gl.RENDERBUFFER, t.depthBufferID)
+		gl.RenderbufferStorage(gl.RENDERBUFFER, gl.DEPTH_COMPONENT16, w, h)
+	}
+
+	t.framebufferID = gl.CreateFramebuffer()
+	gl.BindFramebuffer(gl.FRAMEBUFFER, t.framebufferID)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, t.colorID, 0)
+	switch depth {
+	case depthTexture:
+		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.TEXTURE_2D, t.depthID, 0)
+	case depthBuffer:
+		gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, t.depthBufferID)
+	}
+
+	if gl.CheckFramebufferStatus(gl.FRAMEBUFFER) != gl.FRAMEBUFFER_COMPLETE {
+		return errors.New("incomplete post processing framebuffer")
+	}
+	return nil
+}
+
+func (t *renderTarget) destroy() {
+	gl.DeleteFramebuffer(t.framebufferID)
+	gl.DeleteTexture(t.colorID)
+	if t.depthID.Valid() {
+		gl.DeleteTexture(t.depthID)
+	}
+	if t.depthBufferID.Valid() {
+		gl.DeleteRenderbuffer(t.depthBufferID)
+	}
+	*t = renderTarget{}
+}
+
+// depthTexturesSupported reports if depth textures can be rendered to.
+// Desktop OpenGL always supports them, GLES 2 and WebGL need an extension.
+func depthTexturesSupported() bool {
+	version := gl.GetString(gl.VERSION)
+	if !strings.HasPrefix(version, "OpenGL ES") && !strings.HasPrefix(version, "WebGL") {
+		return true
+	}
+
+	for _, ext := range strings.Split(gl.GetString(gl.EXTENSIONS), " ") {
+		if ext == "GL_OES_depth_texture" || strings.HasSuffix(ext, "WEBGL_depth_texture") {
+			return true
+		}
+	}
+	return false
+}
+
+func createTargetTexture(w, h int, format, ty gl.Enum) gl.Texture {
+	id := gl.CreateTexture()
+	gl.BindTexture(gl.TEXTURE_2D, id)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.LINEAR)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, w, h, format, ty, nil)
+	return id
+}
+
+type postProgram struct {
+	programID      gl.Program
+	positionAttrib gl.Attrib
+	uniforms       map[string]gl.Uniform
+}
+
+func (p *postProgram) create(fragmentSrc string) error {
+	var err error
+	p.programID, err = glutil.CreateProgram(postVertexShaderSrc, fragmentSrc)
+	if err != nil {
+		return err
+	}
+
+	p.positionAttrib = gl.GetAttribLocation(p.programID, "a_position")
+	p.uniforms = make(map[string]gl.Uniform)
+	return nil
+}
+
+func (p *postProgram) destroy() {
+	if p.programID.Valid() {
+		gl.DeleteProgram(p.programID)
+	}
+	*p = postProgram{}
+}
+
+func (p *postProgram) uniform(name string) gl.Uniform {
+	u, ok := p.uniforms[name]
+	if !ok {
+		u = gl.GetUniformLocation(p.programID, name)
+		p.uniforms[name] = u
+	}
+	return u
+}
+
+// postProcessor implements the post processing part of Renderer. When any
+// effect is enabled the scene is rendered to a texture, renderers must call
+// begin instead of clearing the screen and PostProcess before swapping buffers.
+//
+// The alpha channel of the scene is used as the bloom mask.
+type postProcessor struct {
+	effects  display.PostEffects
+	settings display.PostSettings
+	dirty    bool
+	active   bool
+
+	size           image.Point
+	screenID       gl.Framebuffer
+	quadID         gl.Buffer
+	scene, resolve renderTarget
+	bloom          [2]renderTarget
+
+	composite,
+	extract,
+	blur,
+	fxaa postProgram
+}
+
+func (p *postProcessor) SetPostEffects(effects display.PostEffects) {
+	if effects != p.effects {
+		p.effects = effects
+		p.dirty = true
+	}
+}
+
+func (p *postProcessor) PostEffects() display.PostEffects {
+	return p.effects
+}
+
+func (p *postProcessor) SetPostSettings(settings display.PostSettings) {
+	p.settings = settings
+}
+
+func (p *postProcessor) PostSettings() display.PostSettings {
+	return p.settings
+}
+
+// begin redirects rendering to the scene texture and clears it. It returns
+// false if no effects are enabled.
+func (p *postProcessor) begin() bool {
+	if p.effects == display.PostNone {
+		return false
+	}
+
+	var viewport [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, viewport[:])
+	size := image.Pt(int(viewport[2]), int(viewport[3]))
+
+	if p.dirty || size != p.size {
+		p.destroy()
+		if err := p.create(size); err != nil {
+			log.Println("Could not enable post processing:", err)
+			p.destroy()
+			p.effects = display.PostNone
+			return false
+		}
+	}
+
+	p.screenID = gl.GetBoundFramebuffer()
+	gl.BindFramebuffer(gl.FRAMEBUFFER, p.scene.framebufferID)
+
+	// Nothing glows unless it is drawn with an emissive material.
+	var clearColor [4]float32
+	gl.GetFloatv(clearColor[:], gl.COLOR_CLEAR_VALUE)
+	gl.ClearColor(clearColor[0], clearColor[1], clearColor[2], 0)
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	gl.ClearColor(clearColor[0], clearColor[1], clearColor[2], clearColor[3])
+
+	p.active = true
+	return true
+}
+
+func (p *postProcessor) create(size image.Point) error {
+	p.size = size
+	p.dirty = false
+	screen := gl.GetBoundFramebuffer()
+	defer gl.BindFramebuffer(gl.FRAMEBUFFER, screen)
+
+	// Fog reads the depth of the scene, without depth textures it is skipped.
+	effects := p.effects
+	depth := depthTexture
+	if !depthTexturesSupported() {
+		depth = depthBuffer
+		if effects&display.PostFog != 0 {
+			log.Println("Depth textures are not supported, fog is disabled")
+			effects &^= display.PostFog
+		}
+	}
+
+	if err := p.scene.create(size.X, size.Y, depth); err != nil {
+		return err
+	}
+
+	p.quadID = gl.CreateBuffer()
+	gl.BindBuffer(gl.ARRAY_BUFFER, p.quadID)
+	gl.BufferData(gl.ARRAY_BUFFER, []byte{0xFF, 0xFF, 1, 0xFF, 0xFF, 1, 1, 1}, gl.STATIC_DRAW)
+
+	if err := p.composite.create(postDefines(effects) + compositeFragmentShaderSrc); err != nil {
+		return err
+	}
+
+	if p.effects&display.PostBloom != 0 {
+		for i := range p.bloom {
+			if err := p.bloom[i].create(size.X/2, size.Y/2, noDepth); err != nil {
+				return err
+			}
+		}
+
+		if err := p.extract.create(extractFragmentShaderSrc); err != nil {
+			return err
+		}
+		if err := p.blur.create(blurFragmentShaderSrc); err != nil {
+			return err
+		}
+	}
+
+	if p.effects&display.PostFXAA != 0 {
+		if err := p.resolve.create(size.X, size.Y, noDepth); err != nil {
+			return err
+		}
+		if err := p.fxaa.create(fxaaFragmentShaderSrc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *postProcessor) destroy() {
+	if p.scene.framebufferID.Valid() {
+		p.scene.destroy()
+		gl.DeleteBuffer(p.quadID)
+	}
+	if p.resolve.framebufferID.Valid() {
+		p.resolve.destroy()
+	}
+	for i := range p.bloom {
+		if p.bloom[i].framebufferID.Valid() {
+			p.bloom[i].destroy()
+		}
+	}
+
+	p.composite.destroy()
+	p.extract.destroy()
+	p.blur.destroy()
+	p.fxaa.destroy()
+	p.size = image.ZP
+}
+
+// PostProcess applies the effects to the scene rendered since Clear and
+// draws it to the screen. Anything drawn after it, like the HUD, is not
+// affected by the effects.
+func (p *postProcessor) PostProcess() {
+	if !p.active {
+		return
+	}
+	p.active = false
+
+	gl.Disable(gl.DEPTH_TEST)
+	gl.Disable(gl.BLEND)
+	gl.Disable(gl.CULL_FACE)
+
+	if p.effects&display.PostBloom != 0 {
+		half := p.size.Div(2)
+		gl.Viewport(0, 0, half.X, half.Y)
+
+		p.draw(&p.extract, &p.bloom[0], p.scene.colorID)
+
+		gl.UseProgram(p.blur.programID)
+		gl.Uniform2f(p.blur.uniform("u_direction"), 1/float32(half.X), 0)
+		p.draw(&p.blur, &p.bloom[1], p.bloom[0].colorID)
+		gl.Uniform2f(p.blur.uniform("u_direction"), 0, 1/float32(half.Y))
+		p.draw(&p.blur, &p.bloom[0], p.bloom[1].colorID)
+
+		gl.Viewport(0, 0, p.size.X, p.size.Y)
+	}
+
+	var target *renderTarget
+	if p.effects&display.PostFXAA != 0 {
+		target = &p.resolve
+	}
+
+	s := &p.settings
+	c := &p.composite
+	gl.UseProgram(c.programID)
+	gl.Uniform1i(c.uniform("u_depth"), 1)
+	gl.Uniform1i(c.uniform("u_bloom"), 2)
+	gl.Uniform3fv(c.uniform("u_fog_color"), s.Fog.Color[:])
+	gl.Uniform2f(c.uniform("u_fog_range"), s.Fog.Start, s.Fog.End)
+	gl.Uniform2f(c.uniform("u_clip"), s.Fog.Near, s.Fog.Far)
+	gl.Uniform1f(c.uniform("u_bloom_intensity"), s.BloomIntensity)
+	gl.Uniform3f(c.uniform("u_grading"), s.Grading.Exposure, s.Grading.Contrast, s.Grading.Saturation)
+
+	gl.ActiveTexture(gl.TEXTURE1)
+	gl.BindTexture(gl.TEXTURE_2D, p.scene.depthID)
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_2D, p.bloom[0].colorID)
+	p.draw(c, target, p.scene.colorID)
+
+	if target != nil {
+		gl.UseProgram(p.fxaa.programID)
+		gl.Uniform2f(p.fxaa.uniform("u_texel"), 1/float32(p.size.X), 1/float32(p.size.Y))
+		p.draw(&p.fxaa, nil, p.resolve.colorID)
+	}
+
+	gl.Enable(gl.DEPTH_TEST)
+}
+
+// draw renders a full screen quad with the program to target, or to the
+// screen if target is nil. The source texture is bound to unit 0.
+func (p *postProcessor) draw(prog *postProgram, target *renderTarget, source gl.Texture) {
+	if target != nil {
+		gl.BindFramebuffer(gl.FRAMEBUFFER, target.framebufferID)
+	} else {
+		gl.BindFramebuffer(gl.FRAMEBUFFER, p.screenID)
+	}
+
+	gl.UseProgram(prog.programID)
+	gl.Uniform1i(prog.uniform("u_texture"), 0)
+
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, source)
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, p.quadID)
+	gl.VertexAttribPointer(prog.positionAttrib, 2, gl.BYTE, false, 0, 0)
+	gl.EnableVertexAttribArray(prog.positionAttrib)
+	gl.DrawArrays(gl.TRIANGLE_STRIP, 0, 4)
+}
+
+func postDefines(effects display.PostEffects) string {
+	defines := "#version 120\n"
+	if effects&display.PostFog != 0 {
+		defines += "#define FOG\n"
+	}
+	if effects&display.PostBloom != 0 {
+		defines += "#define BLOOM\n"
+	}
+	if effects&display.PostToneMapping != 0 {
+		defines += "#define TONE_MAPPING\n"
+	}
+	return defines
+}
+
+var postVertexShaderSrc = `
+	#version 120
+
+	attribute vec2 a_position;
+
+	varying vec2 v_uv;
+
+	void main()
+	{
+		v_uv = a_position * 0.5 + 0.5;
+		gl_Position = vec4(a_position, 0.0, 1.0);
+	}
+`
+
+var compositeFragmentShaderSrc = `
+	uniform sampler2D u_texture;
+	uniform sampler2D u_depth;
+	uniform sampler2D u_bloom;
+
+	uniform vec3 u_fog_color;
+	uniform vec2 u_fog_range;
+	uniform vec2 u_clip;
+	uniform float u_bloom_intensity;
+	uniform vec3 u_grading;
+
+	varying vec2 v_uv;
+
+	void main()
+	{
+		vec3 color = texture2D(u_texture, v_uv).rgb;
+
+		#ifdef FOG
+		float z = texture2D(u_depth, v_uv).r * 2.0 - 1.0;
+		float near = u_clip.x;
+		float far = u_clip.y;
+		float dist = 2.0 * near * far / (far + near - z * (far - near));
+		float fog = clamp((dist - u_fog_range.x) / (u_fog_range.y - u_fog_range.x), 0.0, 1.0);
+		color = mix(color, u_fog_color, fog);
+		#endif
+
+		#ifdef BLOOM
+		color += texture2D(u_bloom, v_uv).rgb * u_bloom_intensity;
+		#endif
+
+		#ifdef TONE_MAPPING
+		color *= u_grading.x;
+		color = (color * (2.51 * color + 0.03)) / (color * (2.43 * color + 0.59) + 0.14);
+		color = (color - 0.5) * u_grading.y + 0.5;
+		float luma = dot(color, vec3(0.299, 0.587, 0.114));
+		color = mix(vec3(luma), color, u_grading.z);
+		#endif
+
+		gl_FragColor = vec4(clamp(color, 0.0, 1.0), 1.0);
+	}
+`
+
+var extractFragmentShaderSrc = `
+	#version 120
+
+	uniform sampler2D u_texture;
+
+	varying vec2 v_uv;
+
+	void main()
+	{
+		vec4 c = texture2D(u_texture, v_uv);
+		gl_FragColor = vec4(c.rgb * c.a, 1.0);
+	}
+`
+
+var blurFragmentShaderSrc = `
+	#version 120
+
+	uniform sampler2D u_texture;
+	uniform vec2 u_direction;
+
+	varying vec2 v_uv;
+
+	void main()
+	{
+		// Nine tap gaussian using linear filtering between texels.
+		vec3 c = texture2D(u_texture, v_uv).rgb * 0.2270270270;
+		c += texture2D(u_texture, v_uv + u_direction * 1.3846153846).rgb * 0.3162162162;
+		c += texture2D(u_texture, v_uv - u_direction * 1.3846153846).rgb * 0.3162162162;
+		c += texture2D(u_texture, v_uv + u_direction * 3.2307692308).rgb * 0.0702702703;
+		c += texture2D(u_texture, v_uv - u_direction * 3.2307692308).rgb * 0.0702702703;
+		gl_FragColor = vec4(c, 1.0);
+	}
+`
+
+var fxaaFragmentShaderSrc = `
+	#version 120
+
+	#define FXAA_REDUCE_MIN (1.0 / 128.0)
+	#define FXAA_REDUCE_MUL (1.0 / 8.0)
+	#define FXAA_SPAN_MAX 8.0
+
+	uniform sampler2D u_texture;
+	uniform vec2 u_texel;
+
+	varying vec2 v_uv;
+
+	void main()
+	{
+		const vec3 luma = vec3(0.299, 0.587, 0.114);
+
+		vec3 rgbNW = texture2D(u_texture, v_uv + vec2(-1.0, -1.0) * u_texel).rgb;
+		vec3 rgbNE = texture2D(u_texture, v_uv + vec2(1.0, -1.0) * u_texel).rgb;
+		vec3 rgbSW = texture2D(u_texture, v_uv + vec2(-1.0, 1.0) * u_texel).rgb;
+		vec3 rgbSE = texture2D(u_texture, v_uv + vec2(1.0, 1.0) * u_texel).rgb;
+		vec3 rgbM = texture2D(u_texture, v_uv).rgb;
+
+		float lumaNW = dot(rgbNW, luma);
+		float lumaNE = dot(rgbNE, luma);
+		float lumaSW = dot(rgbSW, luma);
+		float lumaSE = dot(rgbSE, luma);
+		float lumaM = dot(rgbM, luma);
+
+		float lumaMin = min(lumaM, min(min(lumaNW, lumaNE), min(lumaSW, lumaSE)));
+		float lumaMax = max(lumaM, max(max(lumaNW, lumaNE), max(lumaSW, lumaSE)));
+
+		vec2 dir = vec2(-((lumaNW + lumaNE) - (lumaSW + lumaSE)), (lumaNW + lumaSW) - (lumaNE + lumaSE));
+		float dirReduce = max((lumaNW + lumaNE + lumaSW + lumaSE) * (0.25 * FXAA_REDUCE_MUL), FXAA_REDUCE_MIN);
+		float rcpDirMin = 1.0 / (min(abs(dir.x), abs(dir.y)) + dirReduce);
+		dir = clamp(dir * rcpDirMin, vec2(-FXAA_SPAN_MAX), vec2(FXAA_SPAN_MAX)) * u_texel;
+
+		vec3 rgbA = 0.5 * (
+			texture2D(u_texture, v_uv + dir * (1.0 / 3.0 - 0.5)).rgb +
+			texture2D(u_texture, v_uv + dir * (2.0 / 3.0 - 0.5)).rgb);
+		vec3 rgbB = rgbA * 0.5 + 0.25 * (
+			texture2D(u_texture, v_uv - dir * 0.5).rgb +
+			texture2D(u_texture, v_uv + dir * 0.5).rgb);
+
+		float lumaB = dot(rgbB, luma);
+		if (lumaB < lumaMin || lumaB > lumaMax) {
+			gl_FragColor = vec4(rgbA, 1.0);
+		} else {
+			gl_FragColor = vec4(rgbB, 1.0);
+		}
+	}
+`
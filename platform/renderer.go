@@ -12,14 +12,6 @@ import (
 	"github.com/goxjs/gl"
 )
 
-type Renderer interface {
-	Clear()
-	Present()
-	Shutdown()
-	ToggleFullscreen()
-	SetWindowTitle(title string)
-}
-
 func LogGLInfo() {
 	log.Println("OpenGL Info")
 	log.Println(gl.GetString(gl.VERSION))
@@ -7,13 +7,18 @@
 
 package platform
 
-import "github.com/goxjs/gl"
+import (
+	"github.com/andreas-jonsson/voxbox/platform/display"
+	"github.com/goxjs/gl"
+)
 
 type mobileRenderer struct {
+	frameCapture
+	postProcessor
 }
 
 func NewRenderer(configs ...Config) (*mobileRenderer, error) {
-	r := mobileRenderer{}
+	r := mobileRenderer{postProcessor: postProcessor{settings: display.DefaultPostSettings}}
 
 	for _, cfg := range configs {
 		if err = cfg(&rnd); err != nil {
@@ -28,14 +33,32 @@ func (p *mobileRenderer) ToggleFullscreen() {
 }
 
 func (p *mobileRenderer) Clear() {
-	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	if !p.postProcessor.begin() {
+		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	}
 }
 
 func (p *mobileRenderer) Present() {
+	p.PostProcess()
+	p.frameCapture.present()
 }
 
 func (p *mobileRenderer) Shutdown() {
+	p.postProcessor.destroy()
 }
 
 func (p *mobileRenderer) SetWindowTitle(title string) {
 }
+
+// SetRelativeMouse has no effect, there is no cursor on mobile.
+func (p *mobileRenderer) SetRelativeMouse(enabled bool) {
+}
+
+func (p *mobileRenderer) RelativeMouse() bool {
+	return false
+}
+
+func (p *mobileRenderer) SetMouseSensitivity(sensitivity float32, invertY bool) {
+	mouseLook.sensitivity = sensitivity
+	mouseLook.invertY = invertY
+}
@@ -11,6 +11,7 @@ import (
 	"image"
 	"log"
 
+	"github.com/andreas-jonsson/voxbox/platform/display"
 	"github.com/goxjs/gl"
 	"github.com/veandco/go-sdl2/sdl"
 )
@@ -56,6 +57,9 @@ func ConfigWithNoVSync(rnd *sdlRenderer) error {
 }
 
 type sdlRenderer struct {
+	frameCapture
+	postProcessor
+
 	window    *sdl.Window
 	glContext sdl.GLContext
 
@@ -71,10 +75,10 @@ type sdlRenderer struct {
 func NewRenderer(configs ...Config) (*sdlRenderer, error) {
 	var (
 		err error
-		rnd sdlRenderer
+		rnd = sdlRenderer{postProcessor: postProcessor{settings: display.DefaultPostSettings}}
 		dm  sdl.DisplayMode
 
-		sdlFlags uint32 = sdl.WINDOW_SHOWN | sdl.WINDOW_OPENGL
+		sdlFlags uint32 = sdl.WINDOW_SHOWN | sdl.WINDOW_OPENGL | sdl.WINDOW_RESIZABLE | sdl.WINDOW_ALLOW_HIGHDPI
 	)
 
 	for _, cfg := range configs {
@@ -95,6 +99,10 @@ func NewRenderer(configs ...Config) (*sdlRenderer, error) {
 		cfg.windowSize.Y = int(dm.H)
 	}
 
+	if cfg.fulscreen {
+		sdlFlags |= fulscreenFlag
+	}
+
 	if cfg.resolutionDiv > 0 {
 		cfg.windowSize.X /= cfg.resolutionDiv
 		cfg.windowSize.Y /= cfg.resolutionDiv
@@ -124,17 +132,35 @@ func NewRenderer(configs ...Config) (*sdlRenderer, error) {
 	}
 
 	gl.ContextWatcher.OnMakeCurrent(nil)
+	resizeViewport(rnd.window)
+
 	if cfg.novsync {
 		sdl.GL_SetSwapInterval(0)
 	} else {
 		sdl.GL_SetSwapInterval(1)
 	}
 
-	rnd.window.SetGrab(true)
-	sdl.ShowCursor(0)
 	return &rnd, nil
 }
 
+// SetRelativeMouse hides and grabs the cursor and reports only relative
+// mouse motion while enabled.
+func (rnd *sdlRenderer) SetRelativeMouse(enabled bool) {
+	if sdl.SetRelativeMouseMode(enabled) < 0 {
+		log.Println("Could not set relative mouse mode:", sdl.GetError())
+	}
+	rnd.window.SetGrab(enabled)
+}
+
+func (rnd *sdlRenderer) RelativeMouse() bool {
+	return sdl.GetRelativeMouseMode()
+}
+
+func (rnd *sdlRenderer) SetMouseSensitivity(sensitivity float32, invertY bool) {
+	mouseLook.sensitivity = sensitivity
+	mouseLook.invertY = invertY
+}
+
 func (rnd *sdlRenderer) ToggleFullscreen() {
 	isFullscreen := (rnd.window.GetFlags() & fulscreenFlag) != 0
 	if isFullscreen {
@@ -145,10 +171,14 @@ func (rnd *sdlRenderer) ToggleFullscreen() {
 }
 
 func (rnd *sdlRenderer) Clear() {
-	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	if !rnd.postProcessor.begin() {
+		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+	}
 }
 
 func (rnd *sdlRenderer) Present() {
+	rnd.PostProcess()
+	rnd.frameCapture.present()
 	sdl.GL_SwapWindow(rnd.window)
 	if rnd.config.debug {
 		checkGLError()
@@ -156,6 +186,7 @@ func (rnd *sdlRenderer) Present() {
 }
 
 func (rnd *sdlRenderer) Shutdown() {
+	rnd.postProcessor.destroy()
 	gl.ContextWatcher.OnDetach()
 	sdl.GL_DeleteContext(rnd.glContext)
 	rnd.window.Destroy()
@@ -165,6 +196,19 @@ func (rnd *sdlRenderer) SetWindowTitle(title string) {
 	rnd.window.SetTitle(title)
 }
 
+// resizeViewport sets the viewport to the drawable size of window and
+// updates the scale of mouse coordinates.
+func resizeViewport(window *sdl.Window) image.Point {
+	w, h := sdl.GL_GetDrawableSize(window)
+	if ww, wh := window.GetSize(); ww > 0 && wh > 0 {
+		pixelScale.x = float32(w) / float32(ww)
+		pixelScale.y = float32(h) / float32(wh)
+	}
+
+	gl.Viewport(0, 0, w, h)
+	return image.Pt(w, h)
+}
+
 func checkGLError() {
 	if err := gl.GetError(); err != gl.NO_ERROR {
 		log.Panicf("GL error: 0x%x\n", err)
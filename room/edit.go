@@ -0,0 +1,49 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package room
+
+import (
+	"fmt"
+	"hash/crc32"
+
+	"github.com/andreas-jonsson/voxel/voxel"
+)
+
+// Edit describes a change made to the room by the game, as opposed to the
+// simulation. Edits are recorded with the input of a session so a replay
+// can be checked against the recording.
+type Edit struct {
+	Op  string
+	At  voxel.Point
+	Arg string
+}
+
+func (e Edit) String() string {
+	return fmt.Sprintf("%s %d,%d,%d %s", e.Op, e.At.X, e.At.Y, e.At.Z, e.Arg)
+}
+
+// SetEditHook sets a function that is called with every edit before it is
+// sent to the room.
+func (r *Room) SetEditHook(hook func(Edit)) {
+	r.editHook = hook
+}
+
+// Apply sends f to the room and reports it as e to the edit hook.
+func (r *Room) Apply(e Edit, f func(*Room)) <-chan struct{} {
+	if r.editHook != nil {
+		r.editHook(e)
+	}
+	return r.Send(f)
+}
+
+// Checksum returns a checksum of the voxels, including the simulation flags.
+func (r *Room) Checksum() <-chan uint32 {
+	c := make(chan uint32, 1)
+	r.Send(func(r *Room) {
+		c <- crc32.ChecksumIEEE(r.data)
+	})
+	return c
+}
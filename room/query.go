@@ -0,0 +1,91 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package room
+
+import "github.com/andreas-jonsson/voxel/voxel"
+
+// Region is a copy of the voxels in a box of the room. It is used to make
+// many queries without waiting on the room for each of them.
+type Region struct {
+	box  voxel.Box
+	size voxel.Point
+	data []bool
+}
+
+// Query returns a copy of the voxels in box. Outside of the room it is
+// open above the room and solid everywhere else.
+func (r *Room) Query(box voxel.Box) <-chan *Region {
+	c := make(chan *Region, 1)
+	r.Send(func(r *Room) {
+		size := box.Size()
+		g := &Region{box: box, size: size, data: make([]bool, size.X*size.Y*size.Z)}
+
+		i := 0
+		for z := box.Min.Z; z < box.Max.Z; z++ {
+			for y := box.Min.Y; y < box.Max.Y; y++ {
+				for x := box.Min.X; x < box.Max.X; x++ {
+					if voxel.Pt(x, y, z).In(r.bounds) {
+						g.data[i] = r.data[r.offset(x, y, z)] != 0
+					} else {
+						g.data[i] = y < r.size.Y
+					}
+					i++
+				}
+			}
+		}
+		c <- g
+	})
+	return c
+}
+
+func (g *Region) Bounds() voxel.Box {
+	return g.box
+}
+
+// Solid returns true if there is a voxel at x, y, z. Points outside the
+// region are solid.
+func (g *Region) Solid(x, y, z int) bool {
+	if !voxel.Pt(x, y, z).In(g.box) {
+		return true
+	}
+
+	x, y, z = x-g.box.Min.X, y-g.box.Min.Y, z-g.box.Min.Z
+	return g.data[z*g.size.X*g.size.Y+y*g.size.X+x]
+}
+
+// Collides returns true if any voxel in box is solid.
+func (g *Region) Collides(box voxel.Box) bool {
+	for z := box.Min.Z; z < box.Max.Z; z++ {
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			for x := box.Min.X; x < box.Max.X; x++ {
+				if g.Solid(x, y, z) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Collides returns true if any voxel in box is solid, with the same rules
+// as a Region outside of the room. It must be called on the room goroutine,
+// use Query to collide from other goroutines.
+func (r *Room) Collides(box voxel.Box) bool {
+	for z := box.Min.Z; z < box.Max.Z; z++ {
+		for y := box.Min.Y; y < box.Max.Y; y++ {
+			for x := box.Min.X; x < box.Max.X; x++ {
+				if !voxel.Pt(x, y, z).In(r.bounds) {
+					if y < r.size.Y {
+						return true
+					}
+				} else if r.data[r.offset(x, y, z)] != 0 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
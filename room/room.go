@@ -14,6 +14,7 @@ import (
 	"github.com/andreas-jonsson/voxbox/data"
 	"github.com/andreas-jonsson/voxel/voxel"
 	"github.com/andreas-jonsson/voxel/voxel/vox"
+	"github.com/ungerik/go3d/vec3"
 )
 
 type Flag uint8
@@ -37,6 +38,10 @@ const (
 const (
 	sendBufferSize   = 128
 	markTickDuration = 500 * time.Millisecond
+
+	// markSteps is the number of steps between mark phases when the room
+	// is stepped by Step, 500ms at 60 updates per second.
+	markSteps = 30
 )
 
 /*
@@ -88,6 +93,11 @@ type Room struct {
 	flipYZ        bool
 	flags         Flag
 	data          []uint8
+	palette       color.Palette
+	paletteRow    uint8
+	paused        bool
+	steps         int
+	editHook      func(Edit)
 
 	stepTicker, markTicker *time.Ticker
 
@@ -95,24 +105,54 @@ type Room struct {
 	stopChan chan struct{}
 }
 
+// PaletteImage is implemented by blit destinations that store a palette row
+// per voxel, laid out like Data.
+type PaletteImage interface {
+	PaletteData() []uint8
+}
+
 type Interface interface {
 	Send(f func(*Room)) <-chan struct{}
+	Apply(e Edit, f func(*Room)) <-chan struct{}
+	SetEditHook(hook func(Edit))
+	Checksum() <-chan uint32
 	Clear()
 	Bounds() voxel.Box
 	BlitToView(dst voxel.ImageData, dp voxel.Point, sr voxel.Box) <-chan struct{}
+	Stats() <-chan Stats
+	Inspect(p voxel.Point) <-chan uint8
+	Query(box voxel.Box) <-chan *Region
+	Raycast(from, dir vec3.T, maxDist float32) <-chan *Hit
+	Step()
+	SetPaused(paused bool)
 	Destroy()
 }
 
+type Stats struct {
+	Voxels, Falling, Attached int
+
+	// Queued is the number of functions waiting to run on the room
+	// goroutine when Stats was called.
+	Queued int
+}
+
+// NewRoom creates a room that steps the simulation every simSpeed. With a
+// simSpeed of zero the room is only stepped by calls to Step, which makes
+// the simulation deterministic.
 func NewRoom(size voxel.Point, simSpeed time.Duration) *Room {
-	return &Room{
-		stopChan:   make(chan struct{}),
-		funcChan:   make(chan func(), sendBufferSize),
-		stepTicker: time.NewTicker(simSpeed),
-		markTicker: time.NewTicker(markTickDuration),
-		size:       size,
-		bounds:     voxel.Box{Min: voxel.ZP, Max: size},
-		data:       make([]uint8, size.X*size.Y*size.Z),
+	r := &Room{
+		stopChan: make(chan struct{}),
+		funcChan: make(chan func(), sendBufferSize),
+		size:     size,
+		bounds:   voxel.Box{Min: voxel.ZP, Max: size},
+		data:     make([]uint8, size.X*size.Y*size.Z),
+	}
+
+	if simSpeed > 0 {
+		r.stepTicker = time.NewTicker(simSpeed)
+		r.markTicker = time.NewTicker(markTickDuration)
 	}
+	return r
 }
 
 func (r *Room) Send(f func(*Room)) <-chan struct{} {
@@ -126,31 +166,66 @@ func (r *Room) Send(f func(*Room)) <-chan struct{} {
 
 func (r *Room) Destroy() {
 	r.stopChan <- struct{}{}
-	r.stepTicker.Stop()
-	r.markTicker.Stop()
-
+	if r.stepTicker != nil {
+		r.stepTicker.Stop()
+		r.markTicker.Stop()
+	}
 }
 
 func (r *Room) Clear() {
-	r.Send(func(r *Room) {
+	r.Apply(Edit{Op: "clear"}, func(r *Room) {
 		for i := range r.data {
 			r.data[i] = 0
 		}
 	})
 }
 
+// SetPaused stops or resumes the simulation. Functions sent to the room
+// are still executed while it is paused.
+func (r *Room) SetPaused(paused bool) {
+	r.Send(func(r *Room) {
+		r.paused = paused
+	})
+}
+
+// Step runs one simulation step, unless the room is paused. Every
+// markSteps step also runs the mark phase.
+func (r *Room) Step() {
+	r.Send(func(r *Room) {
+		if r.paused {
+			return
+		}
+
+		r.steps++
+		if r.steps%markSteps == 0 {
+			r.markPhase()
+		}
+		r.stepPhase()
+	})
+}
+
 func (r *Room) Start() Interface {
 	go func(r *Room) {
+		var stepChan, markChan <-chan time.Time
+		if r.stepTicker != nil {
+			stepChan = r.stepTicker.C
+			markChan = r.markTicker.C
+		}
+
 		for {
 			select {
-			case <-r.markTicker.C:
-				r.markPhase()
-			case <-r.stepTicker.C:
-				r.stepPhase()
+			case <-markChan:
+				if !r.paused {
+					r.markPhase()
+				}
+			case <-stepChan:
+				if !r.paused {
+					r.stepPhase()
+				}
 			case f := <-r.funcChan:
 				f()
 			case <-r.stopChan:
-				break
+				return
 			}
 		}
 	}(r)
@@ -266,6 +341,11 @@ func (r *Room) BlitToView(dst voxel.ImageData, dp voxel.Point, sr voxel.Box) <-c
 		srcSize := r.Bounds().Max
 		dstData := dst.Data()
 
+		var dstRows []uint8
+		if pi, ok := dst.(PaletteImage); ok {
+			dstRows = pi.PaletteData()
+		}
+
 		for z, sz := b.Min.Z, sr.Min.Z; z < b.Max.Z; z++ {
 			for y, sy := b.Min.Y, sr.Min.Y; y < b.Max.Y; y++ {
 
@@ -277,6 +357,12 @@ func (r *Room) BlitToView(dst voxel.ImageData, dp voxel.Point, sr voxel.Box) <-c
 					dstSlice[i] = v & invAttachedAndFalling
 				}
 
+				if dstRows != nil {
+					for i := range dstRows[dstStart : dstStart+blockSize] {
+						dstRows[dstStart+i] = r.paletteRow
+					}
+				}
+
 				sy++
 			}
 			sz++
@@ -284,6 +370,43 @@ func (r *Room) BlitToView(dst voxel.ImageData, dp voxel.Point, sr voxel.Box) <-c
 	})
 }
 
+func (r *Room) Stats() <-chan Stats {
+	c := make(chan Stats, 1)
+	queued := len(r.funcChan)
+
+	r.Send(func(r *Room) {
+		s := Stats{Queued: queued}
+		for _, v := range r.data {
+			if v == 0 {
+				continue
+			}
+
+			s.Voxels++
+			if v&Falling != 0 {
+				s.Falling++
+			}
+			if v&Attached != 0 {
+				s.Attached++
+			}
+		}
+		c <- s
+	})
+	return c
+}
+
+// Inspect returns the voxel at p including the Falling and Attached flags.
+func (r *Room) Inspect(p voxel.Point) <-chan uint8 {
+	c := make(chan uint8, 1)
+	r.Send(func(r *Room) {
+		if p.In(r.bounds) {
+			c <- r.data[r.offset(p.X, p.Y, p.Z)]
+		} else {
+			c <- 0
+		}
+	})
+	return c
+}
+
 func (r *Room) Bounds() voxel.Box {
 	return r.bounds
 }
@@ -291,7 +414,22 @@ func (r *Room) Bounds() voxel.Box {
 func (r *Room) SetBounds(b voxel.Box) {
 }
 
+// SetPalette is called by the VOX decoder, the last loaded palette is kept.
 func (r *Room) SetPalette(pal color.Palette) {
+	r.palette = pal
+}
+
+func (r *Room) Palette() color.Palette {
+	return r.palette
+}
+
+// SetPaletteRow selects the view palette the room is rendered with.
+func (r *Room) SetPaletteRow(row uint8) {
+	r.paletteRow = row
+}
+
+func (r *Room) PaletteRow() uint8 {
+	return r.paletteRow
 }
 
 func (r *Room) Set(x, y, z int, index uint8) {
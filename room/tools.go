@@ -0,0 +1,140 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package room
+
+import (
+	"github.com/andreas-jonsson/voxel/voxel"
+	"github.com/barnex/fmath"
+	"github.com/ungerik/go3d/vec3"
+)
+
+// MaxColor is the highest palette index a voxel can have, the bits above it
+// hold the simulation flags.
+const MaxColor = invAttachedAndFalling
+
+// Hit is the result of a raycast. Normal points out of the face that was hit.
+type Hit struct {
+	Pos, Normal voxel.Point
+	Index       uint8
+}
+
+// Raycast returns the first voxel along the ray from, in direction dir,
+// within maxDist. It returns nil if nothing was hit.
+func (r *Room) Raycast(from, dir vec3.T, maxDist float32) <-chan *Hit {
+	c := make(chan *Hit, 1)
+	r.Send(func(r *Room) {
+		c <- r.raycast(from, dir, maxDist)
+	})
+	return c
+}
+
+func (r *Room) raycast(from, dir vec3.T, maxDist float32) *Hit {
+	dir.Normalize()
+	for i := range dir {
+		if dir[i] == 0 {
+			dir[i] = 1e-6
+		}
+	}
+
+	cell := [3]int{int(fmath.Floor(from[0])), int(fmath.Floor(from[1])), int(fmath.Floor(from[2]))}
+	var step, normal [3]int
+	var tMax, tDelta [3]float32
+
+	for i := range cell {
+		tDelta[i] = fmath.Abs(1 / dir[i])
+		if dir[i] > 0 {
+			step[i] = 1
+			tMax[i] = (float32(cell[i]+1) - from[i]) / dir[i]
+		} else {
+			step[i] = -1
+			tMax[i] = (float32(cell[i]) - from[i]) / dir[i]
+		}
+	}
+
+	for t := float32(0); t <= maxDist; {
+		p := voxel.Pt(cell[0], cell[1], cell[2])
+		if p.In(r.bounds) {
+			if v := r.data[r.offset(p.X, p.Y, p.Z)]; v != 0 {
+				return &Hit{Pos: p, Normal: voxel.Pt(normal[0], normal[1], normal[2]), Index: v & invAttachedAndFalling}
+			}
+		}
+
+		axis := 0
+		if tMax[1] < tMax[axis] {
+			axis = 1
+		}
+		if tMax[2] < tMax[axis] {
+			axis = 2
+		}
+
+		t = tMax[axis]
+		cell[axis] += step[axis]
+		tMax[axis] += tDelta[axis]
+		normal = [3]int{}
+		normal[axis] = -step[axis]
+	}
+	return nil
+}
+
+// Dig removes the voxels within radius of p. The voxels just outside of it
+// are knocked loose and fall as debris.
+func (r *Room) Dig(p voxel.Point, radius int) {
+	debris := radius + 1
+	for z := -debris; z <= debris; z++ {
+		for y := -debris; y <= debris; y++ {
+			for x := -debris; x <= debris; x++ {
+				q := p.Add(voxel.Pt(x, y, z))
+				if !q.In(r.bounds) {
+					continue
+				}
+
+				idx := r.offset(q.X, q.Y, q.Z)
+				v := r.data[idx]
+				if v == 0 {
+					continue
+				}
+
+				switch d := x*x + y*y + z*z; {
+				case d <= radius*radius:
+					r.data[idx] = 0
+				case d <= debris*debris && q.Y > 0:
+					r.data[idx] = (v & invAttachedAndFalling) | Falling
+				}
+			}
+		}
+	}
+}
+
+// Place adds a voxel at p, if it is empty. It is attached if the voxel at
+// support is attached, otherwise it falls.
+func (r *Room) Place(p, support voxel.Point, index uint8) {
+	if !p.In(r.bounds) || index == 0 {
+		return
+	}
+
+	idx := r.offset(p.X, p.Y, p.Z)
+	if r.data[idx] != 0 {
+		return
+	}
+
+	flag := uint8(Falling)
+	if support.In(r.bounds) && r.data[r.offset(support.X, support.Y, support.Z)]&Attached != 0 {
+		flag = Attached
+	}
+	r.data[idx] = (index & invAttachedAndFalling) | flag
+}
+
+// Paint changes the color of the voxel at p and keeps its flags.
+func (r *Room) Paint(p voxel.Point, index uint8) {
+	if !p.In(r.bounds) || index == 0 {
+		return
+	}
+
+	idx := r.offset(p.X, p.Y, p.Z)
+	if v := r.data[idx]; v != 0 {
+		r.data[idx] = (v & attachedOrFalling) | (index & invAttachedAndFalling)
+	}
+}
@@ -0,0 +1,81 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package sprite
+
+import (
+	"time"
+
+	"github.com/andreas-jonsson/voxel/voxel"
+)
+
+// Animator plays the animations of a sprite. Several animators can share
+// the same sprite.
+type Animator struct {
+	sprite *Sprite
+	name   string
+	anim   Animation
+	time   time.Duration
+}
+
+// NewAnimator returns an animator playing the idle animation.
+func NewAnimator(s *Sprite) *Animator {
+	a := &Animator{sprite: s}
+	a.Play(Idle)
+	return a
+}
+
+func (a *Animator) Sprite() *Sprite {
+	return a.sprite
+}
+
+// Play starts the named animation, unless it is already playing. It returns
+// false if the sprite has no such animation.
+func (a *Animator) Play(name string) bool {
+	anim, ok := a.sprite.animations[name]
+	if !ok {
+		return false
+	}
+
+	if name != a.name {
+		a.name, a.anim, a.time = name, anim, 0
+	}
+	return true
+}
+
+// Playing returns the name of the current animation.
+func (a *Animator) Playing() string {
+	return a.name
+}
+
+func (a *Animator) Update(dt time.Duration) {
+	a.time += dt
+}
+
+// Done returns true when an animation that does not loop has reached its
+// last frame.
+func (a *Animator) Done() bool {
+	return !a.anim.Loop && a.step() >= len(a.anim.Frames)-1
+}
+
+// Frame returns the current frame of the sprite.
+func (a *Animator) Frame() int {
+	i := a.step()
+	if a.anim.Loop {
+		i %= len(a.anim.Frames)
+	} else if i >= len(a.anim.Frames) {
+		i = len(a.anim.Frames) - 1
+	}
+	return a.anim.Frames[i]
+}
+
+func (a *Animator) step() int {
+	return int(a.time.Seconds() * float64(a.anim.Rate))
+}
+
+// Blit draws the current frame, see Sprite.Blit.
+func (a *Animator) Blit(dst voxel.Image, at voxel.Point, facing int) {
+	a.sprite.Blit(dst, at, a.Frame(), facing)
+}
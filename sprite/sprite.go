@@ -0,0 +1,177 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+// Package sprite loads voxel models with several frames and plays named
+// animations of them. Every model in a .vox file is a frame and the
+// animations are read from a JSON file with the same name, if there is one.
+package sprite
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/andreas-jonsson/voxbox/data"
+	"github.com/andreas-jonsson/voxel/voxel"
+)
+
+// Idle is the animation every sprite has. Without an animation file it
+// loops all frames.
+const Idle = "idle"
+
+const defaultRate = 8
+
+type frameVoxel struct {
+	x, y, z, index uint8
+}
+
+// Frame is one model of a sprite. The voxels are stored sparse, most of a
+// model is empty.
+type Frame struct {
+	size   voxel.Point
+	voxels []frameVoxel
+}
+
+// Animation plays frames at Rate frames per second. Animations that do not
+// loop stop at the last frame.
+type Animation struct {
+	Frames []int
+	Rate   float32
+	Loop   bool
+}
+
+type Sprite struct {
+	palette    color.Palette
+	frames     []Frame
+	size       voxel.Point
+	animations map[string]Animation
+}
+
+// Load reads the frames from file and the animations from the file with
+// the extension replaced by .json.
+func Load(file string) (*Sprite, error) {
+	fp, err := data.FS.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	buf, err := ioutil.ReadAll(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sprite{}
+	if s.frames, s.palette, err = decodeVox(buf); err != nil {
+		return nil, err
+	}
+
+	if s.animations, err = loadAnimations(strings.TrimSuffix(file, ".vox")+".json", len(s.frames)); err != nil {
+		return nil, err
+	}
+
+	// Frames are centered in a square footprint so they can be turned.
+	for _, f := range s.frames {
+		n := f.size.X
+		if f.size.Z > n {
+			n = f.size.Z
+		}
+		if n > s.size.X {
+			s.size.X, s.size.Z = n, n
+		}
+		if f.size.Y > s.size.Y {
+			s.size.Y = f.size.Y
+		}
+	}
+	return s, nil
+}
+
+func loadAnimations(file string, numFrames int) (map[string]Animation, error) {
+	animations := make(map[string]Animation)
+
+	fp, err := data.FS.Open(file)
+	if os.IsNotExist(err) {
+		all := make([]int, numFrames)
+		for i := range all {
+			all[i] = i
+		}
+		animations[Idle] = Animation{Frames: all, Rate: defaultRate, Loop: true}
+		return animations, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	if err := json.NewDecoder(fp).Decode(&animations); err != nil {
+		return nil, err
+	}
+
+	if _, ok := animations[Idle]; !ok {
+		return nil, fmt.Errorf("%s has no %s animation", file, Idle)
+	}
+	for name, a := range animations {
+		if len(a.Frames) == 0 || a.Rate <= 0 {
+			return nil, fmt.Errorf("invalid animation: %s", name)
+		}
+		for _, f := range a.Frames {
+			if f < 0 || f >= numFrames {
+				return nil, fmt.Errorf("animation %s has an invalid frame: %d", name, f)
+			}
+		}
+	}
+	return animations, nil
+}
+
+func (s *Sprite) Palette() color.Palette {
+	return s.palette
+}
+
+// Size returns the box every frame fits in, at any facing.
+func (s *Sprite) Size() voxel.Point {
+	return s.size
+}
+
+func (s *Sprite) NumFrames() int {
+	return len(s.frames)
+}
+
+func (s *Sprite) Animation(name string) (Animation, bool) {
+	a, ok := s.animations[name]
+	return a, ok
+}
+
+// Blit draws frame at, turned facing quarter turns around the vertical
+// axis and centered in the footprint of the sprite. It is clipped to dst.
+func (s *Sprite) Blit(dst voxel.Image, at voxel.Point, frame, facing int) {
+	f := &s.frames[frame]
+	size := f.size
+
+	rs := size
+	if facing%2 != 0 {
+		rs.X, rs.Z = size.Z, size.X
+	}
+	at = at.Add(voxel.Pt((s.size.X-rs.X)/2, 0, (s.size.Z-rs.Z)/2))
+	clip := dst.Bounds()
+
+	for _, v := range f.voxels {
+		x, y, z := int(v.x), int(v.y), int(v.z)
+
+		switch facing {
+		case 1:
+			x, z = size.Z-1-z, x
+		case 2:
+			x, z = size.X-1-x, size.Z-1-z
+		case 3:
+			x, z = z, size.X-1-x
+		}
+
+		if p := at.Add(voxel.Pt(x, y, z)); p.In(clip) {
+			dst.Set(p.X, p.Y, p.Z, v.index)
+		}
+	}
+}
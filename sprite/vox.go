@@ -0,0 +1,178 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package sprite
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"io/ioutil"
+
+	"github.com/andreas-jonsson/voxel/voxel"
+)
+
+// maxModelSize is the largest model MagicaVoxel can save.
+const maxModelSize = 256
+
+type chunkHeader struct {
+	ID                        [4]byte
+	ContentSize, ChildrenSize int32
+}
+
+// decodeVox returns every model of a MagicaVoxel file as a frame, and the
+// palette. Palette index i is the color of voxels with index i, files
+// without a palette use the MagicaVoxel default palette.
+func decodeVox(data []byte) ([]Frame, color.Palette, error) {
+	r := bytes.NewReader(data)
+
+	var magic [4]byte
+	var version int32
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		return nil, nil, err
+	}
+	if string(magic[:]) != "VOX " {
+		return nil, nil, errors.New("not a vox file")
+	}
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		frames  []Frame
+		palette color.Palette
+		size    [3]int32
+	)
+
+	for {
+		var h chunkHeader
+		if err := binary.Read(r, binary.LittleEndian, &h); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		if h.ContentSize < 0 || int64(h.ContentSize) > int64(r.Len()) {
+			return nil, nil, fmt.Errorf("invalid size of %s chunk: %d", h.ID, h.ContentSize)
+		}
+		content := io.LimitReader(r, int64(h.ContentSize))
+
+		switch string(h.ID[:]) {
+		case "MAIN":
+			// The other chunks are children of the main chunk.
+			continue
+		case "SIZE":
+			if err := binary.Read(content, binary.LittleEndian, &size); err != nil {
+				return nil, nil, err
+			}
+			for _, n := range size {
+				if n <= 0 || n > maxModelSize {
+					return nil, nil, fmt.Errorf("invalid model size: %v", size)
+				}
+			}
+		case "XYZI":
+			f, err := decodeFrame(content, h.ContentSize, size)
+			if err != nil {
+				return nil, nil, err
+			}
+			frames = append(frames, f)
+		case "RGBA":
+			var rgba [256][4]uint8
+			if err := binary.Read(content, binary.LittleEndian, &rgba); err != nil {
+				return nil, nil, err
+			}
+
+			// The chunk starts with the color of index 1.
+			palette = make(color.Palette, 256)
+			palette[0] = color.RGBA{}
+			for i := 1; i < len(palette); i++ {
+				c := rgba[i-1]
+				palette[i] = color.RGBA{c[0], c[1], c[2], c[3]}
+			}
+		}
+
+		// Skip what was not read of the chunk.
+		if _, err := io.Copy(ioutil.Discard, content); err != nil {
+			return nil, nil, err
+		}
+		if h.ChildrenSize != 0 {
+			return nil, nil, fmt.Errorf("unexpected children in %s chunk", h.ID)
+		}
+	}
+
+	if len(frames) == 0 {
+		return nil, nil, errors.New("no models in vox file")
+	}
+	if palette == nil {
+		palette = defaultPalette()
+	}
+	return frames, palette, nil
+}
+
+// decodeFrame reads the voxels of a model from an XYZI chunk of
+// contentSize bytes. The z axis is up in MagicaVoxel and is swapped with y.
+func decodeFrame(r io.Reader, contentSize int32, size [3]int32) (Frame, error) {
+	if size[0] == 0 {
+		return Frame{}, errors.New("model without size")
+	}
+
+	var n int32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return Frame{}, err
+	}
+	if n < 0 || int64(n)*4 > int64(contentSize)-4 {
+		return Frame{}, fmt.Errorf("invalid number of voxels: %d", n)
+	}
+
+	xyzi := make([]byte, 4*int(n))
+	if _, err := io.ReadFull(r, xyzi); err != nil {
+		return Frame{}, err
+	}
+
+	f := Frame{size: voxel.Pt(int(size[0]), int(size[2]), int(size[1]))}
+	f.voxels = make([]frameVoxel, 0, n)
+	for i := 0; i < len(xyzi); i += 4 {
+		v := frameVoxel{x: xyzi[i], y: xyzi[i+2], z: xyzi[i+1], index: xyzi[i+3]}
+		if int(v.x) >= f.size.X || int(v.y) >= f.size.Y || int(v.z) >= f.size.Z {
+			return Frame{}, fmt.Errorf("voxel outside of model: %d,%d,%d", v.x, v.y, v.z)
+		}
+		f.voxels = append(f.voxels, v)
+	}
+	return f, nil
+}
+
+// defaultPalette returns the palette MagicaVoxel uses for files without
+// one. It is a 6x6x6 color cube followed by red, green, blue and gray ramps.
+func defaultPalette() color.Palette {
+	levels := []uint8{0xff, 0xcc, 0x99, 0x66, 0x33, 0x00}
+	ramp := []uint8{0xee, 0xdd, 0xbb, 0xaa, 0x88, 0x77, 0x55, 0x44, 0x22, 0x11}
+
+	p := color.Palette{color.RGBA{}}
+	for _, r := range levels {
+		for _, g := range levels {
+			for _, b := range levels {
+				if r != 0 || g != 0 || b != 0 {
+					p = append(p, color.RGBA{r, g, b, 0xff})
+				}
+			}
+		}
+	}
+
+	for _, c := range [][3]bool{{true, false, false}, {false, true, false}, {false, false, true}, {true, true, true}} {
+		for _, v := range ramp {
+			var rgb [3]uint8
+			for i, on := range c {
+				if on {
+					rgb[i] = v
+				}
+			}
+			p = append(p, color.RGBA{rgb[0], rgb[1], rgb[2], 0xff})
+		}
+	}
+	return p
+}
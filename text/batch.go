@@ -0,0 +1,201 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package text
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+
+	"github.com/goxjs/gl"
+	"github.com/goxjs/gl/glutil"
+)
+
+// ShadowColor is the color of the shadow added by DrawShadow.
+var ShadowColor = color.RGBA{0, 0, 0, 192}
+
+// vertexSize is the size of a glyph vertex in bytes, position and texel
+// coordinates as 16-bit integers followed by the color.
+const vertexSize = 12
+
+// Batch collects text and draws all of it with a single draw call on Flush.
+// Coordinates are in pixels with the origin in the top left corner of the
+// current viewport.
+type Batch struct {
+	font         *Font
+	vertexBuffer []byte
+	bufferID     gl.Buffer
+	bufferSize   int
+
+	programID gl.Program
+	positionAttrib,
+	texcoordAttrib,
+	colorAttrib gl.Attrib
+	screenUniform,
+	textureSizeUniform,
+	textureSampler gl.Uniform
+}
+
+func NewBatch(font *Font) (*Batch, error) {
+	b := &Batch{font: font}
+
+	var err error
+	b.programID, err = glutil.CreateProgram(textVertexShaderSrc, textFragmentShaderSrc)
+	if err != nil {
+		return nil, err
+	}
+
+	b.positionAttrib = gl.GetAttribLocation(b.programID, "a_position")
+	b.texcoordAttrib = gl.GetAttribLocation(b.programID, "a_texcoord")
+	b.colorAttrib = gl.GetAttribLocation(b.programID, "a_color")
+	b.screenUniform = gl.GetUniformLocation(b.programID, "u_screen")
+	b.textureSizeUniform = gl.GetUniformLocation(b.programID, "u_texture_size")
+	b.textureSampler = gl.GetUniformLocation(b.programID, "u_texture")
+
+	b.bufferID = gl.CreateBuffer()
+	return b, nil
+}
+
+func (b *Batch) Destroy() {
+	gl.DeleteProgram(b.programID)
+	gl.DeleteBuffer(b.bufferID)
+}
+
+func (b *Batch) Font() *Font {
+	return b.font
+}
+
+// Draw adds s with the top left corner at x,y. Characters are scaled by an
+// integer factor to keep the font sharp.
+func (b *Batch) Draw(x, y, scale int, c color.RGBA, s string) {
+	f := b.font
+	w, h := f.cellW*scale, f.cellH*scale
+	px := x
+
+	for _, r := range s {
+		if r == '\n' {
+			px = x
+			y += h
+			continue
+		}
+
+		if r != ' ' {
+			u, v := f.cell(r)
+			b.appendVertex(px, y, u, v, c)
+			b.appendVertex(px+w, y, u+f.cellW, v, c)
+			b.appendVertex(px, y+h, u, v+f.cellH, c)
+			b.appendVertex(px+w, y, u+f.cellW, v, c)
+			b.appendVertex(px+w, y+h, u+f.cellW, v+f.cellH, c)
+			b.appendVertex(px, y+h, u, v+f.cellH, c)
+		}
+		px += w
+	}
+}
+
+// DrawShadow adds s like Draw, on top of a shadow offset by one font pixel.
+// The shadow keeps the text readable on top of the game.
+func (b *Batch) DrawShadow(x, y, scale int, c color.RGBA, s string) {
+	b.Draw(x+scale, y+scale, scale, ShadowColor, s)
+	b.Draw(x, y, scale, c, s)
+}
+
+func (b *Batch) Printf(x, y, scale int, c color.RGBA, format string, args ...interface{}) {
+	b.Draw(x, y, scale, c, fmt.Sprintf(format, args...))
+}
+
+func (b *Batch) appendVertex(x, y, u, v int, c color.RGBA) {
+	var vert [vertexSize]byte
+	binary.LittleEndian.PutUint16(vert[0:], uint16(int16(x)))
+	binary.LittleEndian.PutUint16(vert[2:], uint16(int16(y)))
+	binary.LittleEndian.PutUint16(vert[4:], uint16(u))
+	binary.LittleEndian.PutUint16(vert[6:], uint16(v))
+	vert[8], vert[9], vert[10], vert[11] = c.R, c.G, c.B, c.A
+	b.vertexBuffer = append(b.vertexBuffer, vert[:]...)
+}
+
+// Flush draws everything added since the last flush.
+func (b *Batch) Flush() {
+	if len(b.vertexBuffer) == 0 {
+		return
+	}
+
+	var viewport [4]int32
+	gl.GetIntegerv(gl.VIEWPORT, viewport[:])
+
+	gl.Disable(gl.DEPTH_TEST)
+	gl.Disable(gl.CULL_FACE)
+	gl.Enable(gl.BLEND)
+	gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+
+	gl.UseProgram(b.programID)
+	gl.Uniform1i(b.textureSampler, 0)
+	gl.Uniform2f(b.screenUniform, float32(viewport[2]), float32(viewport[3]))
+	gl.Uniform2f(b.textureSizeUniform, float32(b.font.width), float32(b.font.height))
+
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, b.font.textureID)
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, b.bufferID)
+	if len(b.vertexBuffer) > b.bufferSize {
+		b.bufferSize = len(b.vertexBuffer)
+		gl.BufferData(gl.ARRAY_BUFFER, b.vertexBuffer, gl.DYNAMIC_DRAW)
+	} else {
+		gl.BufferSubData(gl.ARRAY_BUFFER, 0, b.vertexBuffer)
+	}
+
+	gl.VertexAttribPointer(b.positionAttrib, 2, gl.SHORT, false, vertexSize, 0)
+	gl.EnableVertexAttribArray(b.positionAttrib)
+	gl.VertexAttribPointer(b.texcoordAttrib, 2, gl.UNSIGNED_SHORT, false, vertexSize, 4)
+	gl.EnableVertexAttribArray(b.texcoordAttrib)
+	gl.VertexAttribPointer(b.colorAttrib, 4, gl.UNSIGNED_BYTE, true, vertexSize, 8)
+	gl.EnableVertexAttribArray(b.colorAttrib)
+
+	gl.DrawArrays(gl.TRIANGLES, 0, len(b.vertexBuffer)/vertexSize)
+
+	gl.DisableVertexAttribArray(b.texcoordAttrib)
+	gl.DisableVertexAttribArray(b.colorAttrib)
+	gl.Disable(gl.BLEND)
+	gl.Enable(gl.DEPTH_TEST)
+
+	b.vertexBuffer = b.vertexBuffer[:0]
+}
+
+var textVertexShaderSrc = `
+	#version 120
+
+	uniform vec2 u_screen;
+	uniform vec2 u_texture_size;
+
+	attribute vec2 a_position;
+	attribute vec2 a_texcoord;
+	attribute vec4 a_color;
+
+	varying vec2 v_uv;
+	varying vec4 v_color;
+
+	void main()
+	{
+		v_uv = a_texcoord / u_texture_size;
+		v_color = a_color;
+
+		vec2 p = a_position / u_screen * 2.0 - 1.0;
+		gl_Position = vec4(p.x, -p.y, 0.0, 1.0);
+	}
+`
+
+var textFragmentShaderSrc = `
+	#version 120
+
+	uniform sampler2D u_texture;
+
+	varying vec2 v_uv;
+	varying vec4 v_color;
+
+	void main()
+	{
+		gl_FragColor = texture2D(u_texture, v_uv) * v_color;
+	}
+`
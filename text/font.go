@@ -0,0 +1,108 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package text
+
+import (
+	"errors"
+	"image"
+	"image/draw"
+	"image/png"
+
+	"github.com/andreas-jonsson/voxbox/data"
+	"github.com/goxjs/gl"
+)
+
+// Font sheets hold the printable ASCII characters in a grid of equally
+// sized cells, 16 columns and 6 rows starting at space.
+const (
+	firstChar    = ' '
+	lastChar     = '~'
+	sheetColumns = 16
+	sheetRows    = 6
+)
+
+const DefaultFont = "font.png"
+
+type Font struct {
+	textureID     gl.Texture
+	width, height int
+	cellW, cellH  int
+}
+
+// LoadFont loads a bitmap font sheet from the data file system.
+func LoadFont(file string) (*Font, error) {
+	fp, err := data.FS.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	src, err := png.Decode(fp)
+	if err != nil {
+		return nil, err
+	}
+
+	size := src.Bounds().Size()
+	if size.X%sheetColumns != 0 || size.Y%sheetRows != 0 {
+		return nil, errors.New("invalid font sheet size")
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, size.X, size.Y))
+	draw.Draw(img, img.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	f := &Font{
+		width:  size.X,
+		height: size.Y,
+		cellW:  size.X / sheetColumns,
+		cellH:  size.Y / sheetRows,
+	}
+
+	f.textureID = gl.CreateTexture()
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, f.textureID)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, size.X, size.Y, gl.RGBA, gl.UNSIGNED_BYTE, img.Pix)
+	return f, nil
+}
+
+func (f *Font) Destroy() {
+	gl.DeleteTexture(f.textureID)
+}
+
+// CharSize returns the size of a character cell in pixels at scale 1.
+func (f *Font) CharSize() image.Point {
+	return image.Pt(f.cellW, f.cellH)
+}
+
+// Measure returns the size of s in pixels at scale.
+func (f *Font) Measure(s string, scale int) image.Point {
+	var w, maxW, lines int
+	for _, r := range s {
+		if r == '\n' {
+			lines++
+			w = 0
+			continue
+		}
+
+		w++
+		if w > maxW {
+			maxW = w
+		}
+	}
+	return image.Pt(maxW*f.cellW*scale, (lines+1)*f.cellH*scale)
+}
+
+// cell returns the top left texel of the glyph for r.
+func (f *Font) cell(r rune) (int, int) {
+	if r < firstChar || r > lastChar {
+		r = '?'
+	}
+	i := int(r - firstChar)
+	return (i % sheetColumns) * f.cellW, (i / sheetColumns) * f.cellH
+}
@@ -0,0 +1,228 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package view
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ungerik/go3d/vec3"
+)
+
+const (
+	chunkSize = 16
+	chunksX   = SizeX / chunkSize
+	chunksY   = SizeY / chunkSize
+	chunksZ   = SizeZ / chunkSize
+
+	maxLOD = 2
+
+	// lodHysteresis is how far, in voxels, the camera must move past a LOD
+	// distance before a chunk switches level. This keeps chunks on the
+	// boundary from flickering between levels.
+	lodHysteresis = 4
+)
+
+// SetLODDistances enables level of detail rendering. Chunks further from the
+// camera than distances[i] are rendered with voxels downsampled 2^(i+1) times.
+// Calling it without distances renders everything at full resolution.
+func (v *View) SetLODDistances(distances ...float32) error {
+	if len(distances) > maxLOD {
+		return fmt.Errorf("at most %d LOD levels are supported", maxLOD)
+	}
+
+	for i := 1; i < len(distances); i++ {
+		if distances[i] <= distances[i-1] {
+			return errors.New("LOD distances must be increasing")
+		}
+	}
+
+	v.lodDistances = append(v.lodDistances[:0], distances...)
+	v.chunkLODs = make([]uint8, chunksX*chunksY*chunksZ)
+	return nil
+}
+
+func (v *View) LODDistances() []float32 {
+	return v.lodDistances
+}
+
+// chunkLevel returns the new level of a chunk at level lod and distance d
+// from the camera.
+func (v *View) chunkLevel(lod int, d float32) int {
+	for lod < len(v.lodDistances) && d >= v.lodDistances[lod]+lodHysteresis {
+		lod++
+	}
+	for lod > 0 && d < v.lodDistances[lod-1]-lodHysteresis {
+		lod--
+	}
+	return lod
+}
+
+func (v *View) buildLODBuffers(buffers []*faceBuffer, camera vec3.T) {
+	// All levels are updated first, faces at chunk borders depend on the
+	// level of the neighbour chunk.
+	chunk := 0
+	for cz := 0; cz < SizeZ; cz += chunkSize {
+		for cy := 0; cy < SizeY; cy += chunkSize {
+			for cx := 0; cx < SizeX; cx += chunkSize {
+				center := vec3.T{float32(cx + chunkSize/2), float32(cy + chunkSize/2), float32(cz + chunkSize/2)}
+				d := vec3.Sub(&center, &camera)
+
+				v.chunkLODs[chunk] = uint8(v.chunkLevel(int(v.chunkLODs[chunk]), d.Length()))
+				chunk++
+			}
+		}
+	}
+
+	chunk = 0
+	for cz := 0; cz < SizeZ; cz += chunkSize {
+		for cy := 0; cy < SizeY; cy += chunkSize {
+			for cx := 0; cx < SizeX; cx += chunkSize {
+				lod := int(v.chunkLODs[chunk])
+				chunk++
+
+				size := 1 << uint(lod)
+				for z := cz; z < cz+chunkSize; z += size {
+					for y := cy; y < cy+chunkSize; y += size {
+						for x := cx; x < cx+chunkSize; x += size {
+							if lod == 0 {
+								v.appendVoxel(buffers, x, y, z)
+							} else {
+								v.appendLODCell(buffers, x, y, z, size)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// chunkCellSize returns the size of the cells in the chunk holding voxel
+// x,y,z.
+func (v *View) chunkCellSize(x, y, z int) int {
+	chunk := (z/chunkSize*chunksY+y/chunkSize)*chunksX + x/chunkSize
+	return 1 << uint(v.chunkLODs[chunk])
+}
+
+// appendLODCell adds the exposed faces of the size^3 block at x,y,z as a
+// single voxel. Ambient occlusion is not calculated for downsampled voxels.
+func (v *View) appendLODCell(buffers []*faceBuffer, x, y, z, size int) {
+	idx, ok := v.lodCell(x, y, z, size)
+	if !ok {
+		return
+	}
+
+	translucent := v.isTranslucent(idx)
+	pal := v.paletteMap[v.paletteRows[idx]]
+	ao := [8]byte{3, 3, 3, 3, 3, 3, 3, 3}
+
+	for _, b := range buffers {
+		dst := b
+		if translucent {
+			if !b.visible {
+				continue
+			}
+			dst = v.transparent
+		}
+
+		if v.isLODFaceExposed(x, y, z, size, b.normal, translucent) {
+			dst.append(b.face, byte(x), byte(y), byte(z), byte(size), v.data[idx], pal, &ao)
+		}
+	}
+}
+
+// isLODFaceExposed reports if the face with normal n of the size^3 cell at
+// x,y,z is visible. The neighbour is sampled at the finer of the two chunk
+// levels, a coarse neighbour block covers the face while a finer chunk only
+// covers it if all its cells along the face are solid.
+func (v *View) isLODFaceExposed(x, y, z, size int, n vec3.T, translucent bool) bool {
+	nx := x + int(n[0])*size
+	ny := y + int(n[1])*size
+	nz := z + int(n[2])*size
+
+	if nx < 0 || ny < 0 || nz < 0 || nx >= SizeX || ny >= SizeY || nz >= SizeZ {
+		return true
+	}
+
+	cell := v.chunkCellSize(nx, ny, nz)
+	if cell > size {
+		cell = size
+	}
+
+	// The layer of neighbour cells next to the face.
+	var base, span [3]int
+	p := [3]int{x, y, z}
+	for i := range p {
+		switch {
+		case n[i] > 0:
+			base[i], span[i] = p[i]+size, 1
+		case n[i] < 0:
+			base[i], span[i] = p[i]-cell, 1
+		default:
+			base[i], span[i] = p[i], size
+		}
+	}
+
+	for cz := base[2]; cz < base[2]+span[2]; cz += cell {
+		for cy := base[1]; cy < base[1]+span[1]; cy += cell {
+			for cx := base[0]; cx < base[0]+span[0]; cx += cell {
+				idx, ok := v.lodCell(cx, cy, cz, cell)
+				if !ok || v.isTranslucent(idx) && !translucent {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// lodCell picks the most common color, and palette, among the solid voxels
+// in the size^3 block at x,y,z. It returns the offset of a voxel with that
+// color or false if the block is empty.
+func (v *View) lodCell(x, y, z, size int) (int, bool) {
+	var (
+		candidates [1 << (3 * maxLOD)]int
+		counts     [1 << (3 * maxLOD)]int
+		n          int
+	)
+
+	for bz := z; bz < z+size; bz++ {
+		for by := y; by < y+size; by++ {
+			for bx := x; bx < x+size; bx++ {
+				idx := offset(bx, by, bz)
+				c := v.data[idx]
+				if c == 0 {
+					continue
+				}
+
+				pal := v.paletteRows[idx]
+				i := 0
+				for i < n && (v.data[candidates[i]] != c || v.paletteRows[candidates[i]] != pal) {
+					i++
+				}
+
+				if i == n {
+					candidates[n] = idx
+					n++
+				}
+				counts[i]++
+			}
+		}
+	}
+
+	if n == 0 {
+		return 0, false
+	}
+
+	best := 0
+	for i := 1; i < n; i++ {
+		if counts[i] > counts[best] {
+			best = i
+		}
+	}
+	return candidates[best], true
+}
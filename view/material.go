@@ -0,0 +1,164 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package view
+
+import (
+	"sort"
+
+	"github.com/barnex/fmath"
+	"github.com/goxjs/gl"
+	"github.com/ungerik/go3d/mat4"
+)
+
+const materialSize = 2
+
+// Material describes how a palette entry is rendered. The zero value is an
+// opaque material lit like any other voxel.
+type Material struct {
+	// Transparency is 0 for opaque and 1 for invisible voxels. Translucent
+	// voxels are drawn after the opaque ones, sorted back to front.
+	Transparency float32
+
+	// Emission blends the voxel towards its unlit palette color, 1 makes
+	// the voxel ignore lights and shadows.
+	Emission float32
+}
+
+func (m Material) encode() (emission, opacity byte) {
+	clamp := func(f float32) byte {
+		return byte(fmath.Min(fmath.Max(f, 0), 1) * 255)
+	}
+	return clamp(m.Emission), clamp(1 - m.Transparency)
+}
+
+// SetMaterial sets the material of index in palette row.
+func (v *View) SetMaterial(row, index uint8, m Material) {
+	idx := (int(row)*paletteSize + int(index)) * materialSize
+	v.materialData[idx], v.materialData[idx+1] = m.encode()
+	v.renderer.uploadPalette(v, int(row))
+}
+
+func (v *View) Material(row, index uint8) Material {
+	idx := (int(row)*paletteSize + int(index)) * materialSize
+	return Material{
+		Transparency: 1 - float32(v.materialData[idx+1])/255,
+		Emission:     float32(v.materialData[idx]) / 255,
+	}
+}
+
+func (v *View) resetMaterials(row int) {
+	data := v.materialData[row*paletteSize*materialSize : (row+1)*paletteSize*materialSize]
+	for i := 0; i < len(data); i += materialSize {
+		data[i], data[i+1] = Material{}.encode()
+	}
+}
+
+// isTranslucent reports if the voxel at idx, in data, is not fully opaque.
+func (v *View) isTranslucent(idx int) bool {
+	row := v.paletteMap[v.paletteRows[idx]]
+	return v.materialData[(int(row)*paletteSize+int(v.data[idx]))*materialSize+1] < 255
+}
+
+// paletteTextures holds the palette colors and materials on the GPU.
+type paletteTextures struct {
+	colorsID,
+	materialsID gl.Texture
+}
+
+func (t *paletteTextures) create() {
+	t.colorsID = gl.CreateTexture()
+	t.materialsID = gl.CreateTexture()
+}
+
+func (t *paletteTextures) destroy() {
+	gl.DeleteTexture(t.colorsID)
+	gl.DeleteTexture(t.materialsID)
+}
+
+// bind binds the colors to texture unit 0 and the materials to unit 3.
+func (t *paletteTextures) bind() {
+	gl.ActiveTexture(gl.TEXTURE3)
+	gl.BindTexture(gl.TEXTURE_2D, t.materialsID)
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, t.colorsID)
+}
+
+func (t *paletteTextures) upload(v *View) {
+	gl.ActiveTexture(gl.TEXTURE3)
+	gl.BindTexture(gl.TEXTURE_2D, t.materialsID)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, paletteSize, maxPalettes, gl.LUMINANCE_ALPHA, gl.UNSIGNED_BYTE, v.materialData)
+
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, t.colorsID)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, paletteSize, maxPalettes, gl.RGB, gl.UNSIGNED_BYTE, v.paletteData)
+}
+
+func (t *paletteTextures) uploadRow(v *View, row int) {
+	start := row * paletteSize * materialSize
+	gl.ActiveTexture(gl.TEXTURE3)
+	gl.BindTexture(gl.TEXTURE_2D, t.materialsID)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, row, paletteSize, 1, gl.LUMINANCE_ALPHA, gl.UNSIGNED_BYTE, v.materialData[start:start+paletteSize*materialSize])
+
+	start = row * paletteSize * 3
+	gl.ActiveTexture(gl.TEXTURE0)
+	gl.BindTexture(gl.TEXTURE_2D, t.colorsID)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, 0, row, paletteSize, 1, gl.RGB, gl.UNSIGNED_BYTE, v.paletteData[start:start+paletteSize*3])
+}
+
+const quadSize = 6 * vertexSize
+
+// quadsByDepth sorts the quads in a face buffer back to front.
+type quadsByDepth struct {
+	data  []byte
+	depth []float32
+	tmp   [quadSize]byte
+}
+
+func (q *quadsByDepth) Len() int {
+	return len(q.depth)
+}
+
+func (q *quadsByDepth) Less(i, j int) bool {
+	return q.depth[i] < q.depth[j]
+}
+
+func (q *quadsByDepth) Swap(i, j int) {
+	a := q.data[i*quadSize : (i+1)*quadSize]
+	b := q.data[j*quadSize : (j+1)*quadSize]
+	copy(q.tmp[:], a)
+	copy(a, b)
+	copy(b, q.tmp[:])
+	q.depth[i], q.depth[j] = q.depth[j], q.depth[i]
+}
+
+// sortTransparent orders the quads of b by their eye space depth, mv is the
+// model view matrix.
+func (v *View) sortTransparent(b *faceBuffer, mv *mat4.T) {
+	a := mv.Array()
+	n := len(b.vertexBuffer) / quadSize
+
+	q := &v.transparentSort
+	q.data = b.vertexBuffer
+	q.depth = q.depth[:0]
+
+	for i := 0; i < n; i++ {
+		var x, y, z float32
+		quad := b.vertexBuffer[i*quadSize : (i+1)*quadSize]
+		for j := 0; j < len(quad); j += vertexSize {
+			x += float32(quad[j])
+			y += float32(quad[j+1])
+			z += float32(quad[j+2])
+		}
+
+		// The camera looks down negative z so the furthest quad has the lowest depth.
+		q.depth = append(q.depth, (a[2]*x+a[6]*y+a[10]*z)/6+a[14])
+	}
+	sort.Sort(q)
+}
@@ -0,0 +1,148 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package view
+
+import (
+	"github.com/andreas-jonsson/voxel/voxel"
+	"github.com/barnex/fmath"
+	"github.com/ungerik/go3d/mat4"
+	"github.com/ungerik/go3d/vec3"
+)
+
+const maxPickSteps = SizeX + SizeY + SizeZ
+
+type Stats struct {
+	Voxels              int
+	Vertices            [6]int
+	TransparentVertices int
+}
+
+// Stats returns the number of solid voxels and the number of vertices in
+// each face buffer after the last BuildBuffers.
+func (v *View) Stats() Stats {
+	var s Stats
+	for _, c := range v.data {
+		if c != 0 {
+			s.Voxels++
+		}
+	}
+
+	for i, b := range v.buffers {
+		s.Vertices[i] = len(b.vertexBuffer) / vertexSize
+	}
+	s.TransparentVertices = len(v.transparent.vertexBuffer) / vertexSize
+	return s
+}
+
+// Pick returns the first solid voxel along the ray through x,y, in
+// normalized device coordinates, using the matrices from the last
+// BuildBuffers.
+func (v *View) Pick(x, y float32) (voxel.Point, bool) {
+	inv, ok := invert(&v.mvpMatrix)
+	if !ok {
+		return voxel.ZP, false
+	}
+
+	near := unproject(&inv, x, y, -1)
+	far := unproject(&inv, x, y, 1)
+	dir := vec3.Sub(&far, &near)
+	dir.Normalize()
+
+	for i := range dir {
+		if dir[i] == 0 {
+			dir[i] = 1e-6
+		}
+	}
+
+	// Move the ray start to where it enters the view volume.
+	tEnter := float32(0)
+	for i, size := range [3]float32{SizeX, SizeY, SizeZ} {
+		t0 := -near[i] / dir[i]
+		t1 := (size - near[i]) / dir[i]
+		tEnter = fmath.Max(tEnter, fmath.Min(t0, t1))
+	}
+
+	p := dir.Scaled(tEnter + 0.001)
+	p.Add(&near)
+
+	cell := [3]int{int(fmath.Floor(p[0])), int(fmath.Floor(p[1])), int(fmath.Floor(p[2]))}
+	var step [3]int
+	var tMax, tDelta [3]float32
+
+	for i := range cell {
+		tDelta[i] = fmath.Abs(1 / dir[i])
+		if dir[i] > 0 {
+			step[i] = 1
+			tMax[i] = (float32(cell[i]+1) - p[i]) / dir[i]
+		} else {
+			step[i] = -1
+			tMax[i] = (float32(cell[i]) - p[i]) / dir[i]
+		}
+	}
+
+	for i := 0; i < maxPickSteps; i++ {
+		pt := voxel.Pt(cell[0], cell[1], cell[2])
+		if pt.In(v.Bounds()) && v.Get(pt.X, pt.Y, pt.Z) != 0 {
+			return pt, true
+		}
+
+		axis := 0
+		if tMax[1] < tMax[axis] {
+			axis = 1
+		}
+		if tMax[2] < tMax[axis] {
+			axis = 2
+		}
+
+		cell[axis] += step[axis]
+		tMax[axis] += tDelta[axis]
+	}
+	return voxel.ZP, false
+}
+
+func unproject(inv *mat4.T, x, y, z float32) vec3.T {
+	a := inv.Array()
+	w := a[3]*x + a[7]*y + a[11]*z + a[15]
+	p := vec3.T{x, y, z}
+	p = transformVec3(inv, &p, 1)
+	p.Scale(1 / w)
+	return p
+}
+
+// invert returns the inverse of m, or false if it is singular.
+func invert(m *mat4.T) (mat4.T, bool) {
+	a := m.Array()
+	var inv [16]float32
+
+	inv[0] = a[5]*a[10]*a[15] - a[5]*a[11]*a[14] - a[9]*a[6]*a[15] + a[9]*a[7]*a[14] + a[13]*a[6]*a[11] - a[13]*a[7]*a[10]
+	inv[4] = -a[4]*a[10]*a[15] + a[4]*a[11]*a[14] + a[8]*a[6]*a[15] - a[8]*a[7]*a[14] - a[12]*a[6]*a[11] + a[12]*a[7]*a[10]
+	inv[8] = a[4]*a[9]*a[15] - a[4]*a[11]*a[13] - a[8]*a[5]*a[15] + a[8]*a[7]*a[13] + a[12]*a[5]*a[11] - a[12]*a[7]*a[9]
+	inv[12] = -a[4]*a[9]*a[14] + a[4]*a[10]*a[13] + a[8]*a[5]*a[14] - a[8]*a[6]*a[13] - a[12]*a[5]*a[10] + a[12]*a[6]*a[9]
+	inv[1] = -a[1]*a[10]*a[15] + a[1]*a[11]*a[14] + a[9]*a[2]*a[15] - a[9]*a[3]*a[14] - a[13]*a[2]*a[11] + a[13]*a[3]*a[10]
+	inv[5] = a[0]*a[10]*a[15] - a[0]*a[11]*a[14] - a[8]*a[2]*a[15] + a[8]*a[3]*a[14] + a[12]*a[2]*a[11] - a[12]*a[3]*a[10]
+	inv[9] = -a[0]*a[9]*a[15] + a[0]*a[11]*a[13] + a[8]*a[1]*a[15] - a[8]*a[3]*a[13] - a[12]*a[1]*a[11] + a[12]*a[3]*a[9]
+	inv[13] = a[0]*a[9]*a[14] - a[0]*a[10]*a[13] - a[8]*a[1]*a[14] + a[8]*a[2]*a[13] + a[12]*a[1]*a[10] - a[12]*a[2]*a[9]
+	inv[2] = a[1]*a[6]*a[15] - a[1]*a[7]*a[14] - a[5]*a[2]*a[15] + a[5]*a[3]*a[14] + a[13]*a[2]*a[7] - a[13]*a[3]*a[6]
+	inv[6] = -a[0]*a[6]*a[15] + a[0]*a[7]*a[14] + a[4]*a[2]*a[15] - a[4]*a[3]*a[14] - a[12]*a[2]*a[7] + a[12]*a[3]*a[6]
+	inv[10] = a[0]*a[5]*a[15] - a[0]*a[7]*a[13] - a[4]*a[1]*a[15] + a[4]*a[3]*a[13] + a[12]*a[1]*a[7] - a[12]*a[3]*a[5]
+	inv[14] = -a[0]*a[5]*a[14] + a[0]*a[6]*a[13] + a[4]*a[1]*a[14] - a[4]*a[2]*a[13] - a[12]*a[1]*a[6] + a[12]*a[2]*a[5]
+	inv[3] = -a[1]*a[6]*a[11] + a[1]*a[7]*a[10] + a[5]*a[2]*a[11] - a[5]*a[3]*a[10] - a[9]*a[2]*a[7] + a[9]*a[3]*a[6]
+	inv[7] = a[0]*a[6]*a[11] - a[0]*a[7]*a[10] - a[4]*a[2]*a[11] + a[4]*a[3]*a[10] + a[8]*a[2]*a[7] - a[8]*a[3]*a[6]
+	inv[11] = -a[0]*a[5]*a[11] + a[0]*a[7]*a[9] + a[4]*a[1]*a[11] - a[4]*a[3]*a[9] - a[8]*a[1]*a[7] + a[8]*a[3]*a[5]
+	inv[15] = a[0]*a[5]*a[10] - a[0]*a[6]*a[9] - a[4]*a[1]*a[10] + a[4]*a[2]*a[9] + a[8]*a[1]*a[6] - a[8]*a[2]*a[5]
+
+	det := a[0]*inv[0] + a[1]*inv[4] + a[2]*inv[8] + a[3]*inv[12]
+	if det == 0 {
+		return mat4.T{}, false
+	}
+
+	var r mat4.T
+	ra := r.Array()
+	for i := range inv {
+		ra[i] = inv[i] / det
+	}
+	return r, true
+}
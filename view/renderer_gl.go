@@ -0,0 +1,367 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package view
+
+import (
+	"log"
+	"strings"
+
+	"github.com/goxjs/gl"
+	"github.com/goxjs/gl/glutil"
+	"github.com/ungerik/go3d/mat4"
+)
+
+type glRenderer struct {
+	palettes        paletteTextures
+	vertexBufferIDs [transparentFaces + 1][nBuffers]gl.Buffer
+	bufferCount     [transparentFaces + 1]uint32
+	shadow          shadowMap
+
+	voxelProgramID gl.Program
+	positionAttrib,
+	attribAttrib gl.Attrib
+	lights lightUniforms
+	mvpUniform,
+	mvUniform,
+	palettesSampler,
+	materialsSampler,
+	shadowMVPUniform,
+	shadowSampler,
+	shadowTexelUniform,
+	shadowBiasUniform gl.Uniform
+}
+
+func (r *glRenderer) init(v *View) error {
+	r.palettes.create()
+
+	for i := range r.vertexBufferIDs {
+		for j := range r.vertexBufferIDs[i] {
+			r.vertexBufferIDs[i][j] = gl.CreateBuffer()
+		}
+	}
+	return r.createVoxelProgram()
+}
+
+// createVoxelProgram (re)compiles the voxel shaders with the defines needed
+// by the current settings.
+func (r *glRenderer) createVoxelProgram() error {
+	defines := "#version 120\n" + r.shadow.defines()
+	vertexSrc := strings.Replace(vertexShaderSrc, "#version 120\n", defines, 1)
+	fragmentSrc := strings.Replace(fragmentShaderSrc, "#version 120\n", defines, 1)
+
+	program, err := glutil.CreateProgram(vertexSrc, fragmentSrc)
+	if err != nil {
+		return err
+	}
+
+	if r.voxelProgramID.Valid() {
+		gl.DeleteProgram(r.voxelProgramID)
+	}
+	r.voxelProgramID = program
+
+	r.positionAttrib = gl.GetAttribLocation(program, "a_position")
+	r.attribAttrib = gl.GetAttribLocation(program, "a_attrib")
+	r.mvpUniform = gl.GetUniformLocation(program, "u_mvp")
+	r.mvUniform = gl.GetUniformLocation(program, "u_mv")
+	r.palettesSampler = gl.GetUniformLocation(program, "u_palettes")
+	r.materialsSampler = gl.GetUniformLocation(program, "u_materials")
+	r.lights.locate(program)
+	r.shadowMVPUniform = gl.GetUniformLocation(program, "u_shadow_mvp")
+	r.shadowSampler = gl.GetUniformLocation(program, "u_shadow_map")
+	r.shadowTexelUniform = gl.GetUniformLocation(program, "u_shadow_texel")
+	r.shadowBiasUniform = gl.GetUniformLocation(program, "u_shadow_bias")
+	return nil
+}
+
+func (r *glRenderer) destroy() {
+	gl.DeleteProgram(r.voxelProgramID)
+	r.palettes.destroy()
+	r.shadow.destroy()
+
+	for i := range r.vertexBufferIDs {
+		for _, id := range r.vertexBufferIDs[i] {
+			gl.DeleteBuffer(id)
+		}
+	}
+}
+
+func (r *glRenderer) setState(v *View) {
+	gl.Disable(gl.CULL_FACE)
+	gl.Disable(gl.BLEND)
+	gl.Enable(gl.DEPTH_TEST)
+
+	gl.UseProgram(r.voxelProgramID)
+	gl.Uniform1i(r.palettesSampler, 0)
+	gl.Uniform1i(r.shadowSampler, 1)
+	gl.Uniform1i(r.materialsSampler, 3)
+
+	if r.shadow.enabled() {
+		gl.ActiveTexture(gl.TEXTURE1)
+		gl.BindTexture(gl.TEXTURE_2D, r.shadow.textureID)
+	}
+
+	r.palettes.bind()
+}
+
+func (r *glRenderer) uploadPalettes(v *View) {
+	r.palettes.upload(v)
+}
+
+func (r *glRenderer) uploadPalette(v *View, row int) {
+	r.palettes.uploadRow(v, row)
+}
+
+func (r *glRenderer) setShadowQuality(v *View, q ShadowQuality) error {
+	r.shadow.destroy()
+	if q != ShadowsOff {
+		if err := r.shadow.create(q); err != nil {
+			// Shadows are off, the voxel program must not sample them.
+			if perr := r.createVoxelProgram(); perr != nil {
+				log.Println("Could not create voxel program:", perr)
+			}
+			return err
+		}
+	}
+	return r.createVoxelProgram()
+}
+
+func (r *glRenderer) render(v *View) error {
+	if r.shadow.enabled() {
+		r.renderShadowMap(v)
+		r.setState(v)
+	}
+
+	gl.UniformMatrix4fv(r.mvpUniform, v.mvpMatrix.Slice())
+
+	m := v.viewMatrix
+	m.MultMatrix(&v.modelMatrix)
+	gl.UniformMatrix4fv(r.mvUniform, m.Slice())
+
+	r.lights.set(v, &m)
+
+	if r.shadow.enabled() {
+		gl.UniformMatrix4fv(r.shadowMVPUniform, r.shadow.mvpMatrix.Slice())
+		gl.Uniform1f(r.shadowTexelUniform, 1/float32(r.shadow.size))
+		gl.Uniform1f(r.shadowBiasUniform, v.shadowBias)
+	}
+
+	for _, b := range v.buffers {
+		if b.visible {
+			r.draw(b, r.positionAttrib, r.attribAttrib)
+		}
+	}
+
+	// Translucent faces are sorted back to front and must not hide each other.
+	if len(v.transparent.vertexBuffer) > 0 {
+		gl.Enable(gl.BLEND)
+		gl.BlendFuncSeparate(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA, gl.ZERO, gl.ONE)
+		gl.DepthMask(false)
+
+		r.draw(v.transparent, r.positionAttrib, r.attribAttrib)
+
+		gl.DepthMask(true)
+		gl.Disable(gl.BLEND)
+	}
+	return nil
+}
+
+// draw renders the buffer with the vertex data bound to attribs in order,
+// four bytes each. The data is uploaded on the first draw after a rebuild.
+func (r *glRenderer) draw(b *faceBuffer, attribs ...gl.Attrib) {
+	if len(b.vertexBuffer) > 0 {
+		ids := &r.vertexBufferIDs[b.face]
+		if !b.uploaded {
+			r.bufferCount[b.face]++
+			gl.BindBuffer(gl.ARRAY_BUFFER, ids[r.bufferCount[b.face]%nBuffers])
+			gl.BufferData(gl.ARRAY_BUFFER, b.vertexBuffer, gl.STREAM_DRAW)
+			b.uploaded = true
+		} else {
+			gl.BindBuffer(gl.ARRAY_BUFFER, ids[r.bufferCount[b.face]%nBuffers])
+		}
+
+		for i, a := range attribs {
+			gl.VertexAttribPointer(a, 4, gl.UNSIGNED_BYTE, false, vertexSize, i*4)
+			gl.EnableVertexAttribArray(a)
+		}
+
+		gl.DrawArrays(gl.TRIANGLES, 0, len(b.vertexBuffer)/vertexSize)
+	}
+}
+
+func (r *glRenderer) needsMesh() bool {
+	return true
+}
+
+// lightUniforms are the lighting uniforms shared by the voxel shaders.
+type lightUniforms struct {
+	ambient,
+	aoStrength,
+	lightDir,
+	lightColor,
+	pointPos,
+	pointColor,
+	pointRadius gl.Uniform
+}
+
+func (u *lightUniforms) locate(program gl.Program) {
+	u.ambient = gl.GetUniformLocation(program, "u_ambient")
+	u.aoStrength = gl.GetUniformLocation(program, "u_ao_strength")
+	u.lightDir = gl.GetUniformLocation(program, "u_light_dir")
+	u.lightColor = gl.GetUniformLocation(program, "u_light_color")
+	u.pointPos = gl.GetUniformLocation(program, "u_point_pos")
+	u.pointColor = gl.GetUniformLocation(program, "u_point_color")
+	u.pointRadius = gl.GetUniformLocation(program, "u_point_radius")
+}
+
+// set uploads the lights transformed to eye space by mv.
+func (u *lightUniforms) set(v *View, mv *mat4.T) {
+	gl.Uniform3fv(u.ambient, v.ambient.Slice())
+	gl.Uniform1f(u.aoStrength, v.aoStrength)
+
+	dir, pointPos := v.eyeSpaceLights(mv)
+	gl.Uniform3fv(u.lightDir, dir.Slice())
+	gl.Uniform3fv(u.lightColor, v.sun.Color.Slice())
+
+	var (
+		pos, color [maxPointLights * 3]float32
+		radius     [maxPointLights]float32
+	)
+
+	for i, l := range v.pointLights {
+		copy(pos[i*3:], pointPos[i][:])
+		copy(color[i*3:], l.Color[:])
+		radius[i] = l.Radius
+	}
+
+	gl.Uniform3fv(u.pointPos, pos[:])
+	gl.Uniform3fv(u.pointColor, color[:])
+	gl.Uniform1fv(u.pointRadius, radius[:])
+}
+
+var vertexShaderSrc = `#version 120
+
+	#define MAX_POINT_LIGHTS 4
+
+	uniform mat4 u_mvp;
+	uniform mat4 u_mv;
+
+	uniform vec3 u_ambient;
+	uniform float u_ao_strength;
+	uniform vec3 u_light_dir;
+	uniform vec3 u_light_color;
+
+	uniform vec3 u_point_pos[MAX_POINT_LIGHTS];
+	uniform vec3 u_point_color[MAX_POINT_LIGHTS];
+	uniform float u_point_radius[MAX_POINT_LIGHTS];
+
+	#ifdef SHADOWS
+	uniform mat4 u_shadow_mvp;
+	varying vec4 v_shadow_coord;
+	#endif
+
+	attribute vec4 a_position;
+	attribute vec4 a_attrib;
+
+	varying vec2 v_palette_coord;
+	varying vec3 v_light;
+	varying vec3 v_sun;
+
+	vec3 unpack_normal(float p)
+	{
+		return vec3(mod(p, 3.0), mod(floor(p / 3.0), 3.0), floor(p / 9.0)) - 1.0;
+	}
+
+	void main()
+	{
+		v_palette_coord = (vec2(a_position.w, a_attrib.y) + 0.5) / 256.0;
+
+		// Lighting
+
+		vec3 position = (u_mv * vec4(a_position.xyz, 1.0)).xyz;
+		vec3 normal = normalize(mat3(u_mv) * unpack_normal(a_attrib.z));
+
+		float ao = 1.0 - u_ao_strength * (1.0 - a_attrib.x / 3.0);
+		vec3 light = u_ambient * ao;
+
+		for (int i = 0; i < MAX_POINT_LIGHTS; i++) {
+			if (u_point_radius[i] > 0.0) {
+				vec3 d = u_point_pos[i] - position;
+				float attenuation = max(1.0 - length(d) / u_point_radius[i], 0.0);
+				light += max(dot(normal, normalize(d)), 0.0) * attenuation * u_point_color[i];
+			}
+		}
+
+		v_light = light;
+		v_sun = max(dot(normal, u_light_dir), 0.0) * u_light_color;
+
+		#ifdef SHADOWS
+		v_shadow_coord = u_shadow_mvp * vec4(a_position.xyz, 1.0);
+		#endif
+
+		gl_Position = u_mvp * vec4(a_position.xyz, 1.0);
+	}
+`
+
+var fragmentShaderSrc = `#version 120
+
+	uniform sampler2D u_palettes;
+	uniform sampler2D u_materials;
+
+	varying vec2 v_palette_coord;
+	varying vec3 v_light;
+	varying vec3 v_sun;
+
+	#ifdef SHADOWS
+	uniform sampler2D u_shadow_map;
+	uniform float u_shadow_texel;
+	uniform float u_shadow_bias;
+
+	varying vec4 v_shadow_coord;
+
+	float unpack_depth(vec4 c)
+	{
+		const vec4 shift = vec4(1.0 / (256.0 * 256.0 * 256.0), 1.0 / (256.0 * 256.0), 1.0 / 256.0, 1.0);
+		return dot(c, shift);
+	}
+
+	float shadow()
+	{
+		vec3 coord = v_shadow_coord.xyz / v_shadow_coord.w * 0.5 + 0.5;
+		float depth = coord.z - u_shadow_bias;
+		float lit = 0.0;
+
+		for (int y = -PCF_RADIUS; y <= PCF_RADIUS; y++) {
+			for (int x = -PCF_RADIUS; x <= PCF_RADIUS; x++) {
+				vec2 offset = vec2(float(x), float(y)) * u_shadow_texel;
+				lit += step(depth, unpack_depth(texture2D(u_shadow_map, coord.xy + offset)));
+			}
+		}
+
+		const float samples = float((PCF_RADIUS * 2 + 1) * (PCF_RADIUS * 2 + 1));
+		return lit / samples;
+	}
+	#endif
+
+	void main()
+	{
+		vec3 voxel_color = texture2D(u_palettes, v_palette_coord).xyz;
+		vec4 material = texture2D(u_materials, v_palette_coord);
+
+		#ifdef SHADOWS
+		vec3 light = v_light + v_sun * shadow();
+		#else
+		vec3 light = v_light + v_sun;
+		#endif
+
+		// Emissive voxels bypass the lighting.
+		light = mix(light, vec3(1.0), material.r);
+
+		// Opaque voxels write their emission to alpha, it is used as the bloom
+		// mask in post processing. The transparent pass keeps the destination alpha.
+		float alpha = material.a < 1.0 ? material.a : material.r;
+		gl_FragColor = vec4(voxel_color * light, alpha);
+	}
+`
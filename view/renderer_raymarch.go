@@ -0,0 +1,394 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package view
+
+import (
+	"errors"
+
+	"github.com/goxjs/gl"
+	"github.com/goxjs/gl/glutil"
+)
+
+// The voxel grid is stored as horizontal slices tiled in a 2D texture since
+// GLES 2 has no 3D textures.
+const (
+	raymarchTilesX    = 8
+	raymarchTilesY    = (SizeY + raymarchTilesX - 1) / raymarchTilesX
+	raymarchTexWidth  = SizeX * raymarchTilesX
+	raymarchTexHeight = SizeZ * raymarchTilesY
+	raymarchSliceSize = SizeX * SizeZ * 2
+)
+
+type raymarchRenderer struct {
+	palettes       paletteTextures
+	voxelTextureID gl.Texture
+	cubeBufferID   gl.Buffer
+	cubeSize       int
+
+	// voxelData holds the uploaded slices, one after the other. Only slices
+	// that changed since the last frame are uploaded again.
+	voxelData []byte
+	uploaded  bool
+
+	programID      gl.Program
+	positionAttrib gl.Attrib
+	lights         lightUniforms
+	mvpUniform,
+	mvUniform,
+	cameraUniform,
+	sizeUniform,
+	texSizeUniform,
+	tilesUniform,
+	palettesSampler,
+	materialsSampler,
+	voxelsSampler gl.Uniform
+}
+
+// NewRaymarchRenderer returns a renderer that uploads the voxel data to the
+// GPU and raymarches it in the fragment shader, instead of building meshes
+// on the CPU. It does not support shadows or ambient occlusion. Translucent
+// voxels are blended along the ray.
+func NewRaymarchRenderer() Renderer {
+	return &raymarchRenderer{}
+}
+
+func ConfigWithRaymarching(v *View) error {
+	v.renderer = NewRaymarchRenderer()
+	return nil
+}
+
+func (r *raymarchRenderer) init(v *View) error {
+	var err error
+	r.programID, err = glutil.CreateProgram(raymarchVertexShaderSrc, raymarchFragmentShaderSrc)
+	if err != nil {
+		return err
+	}
+
+	p := r.programID
+	r.positionAttrib = gl.GetAttribLocation(p, "a_position")
+	r.lights.locate(p)
+	r.mvpUniform = gl.GetUniformLocation(p, "u_mvp")
+	r.mvUniform = gl.GetUniformLocation(p, "u_mv")
+	r.cameraUniform = gl.GetUniformLocation(p, "u_camera")
+	r.sizeUniform = gl.GetUniformLocation(p, "u_size")
+	r.texSizeUniform = gl.GetUniformLocation(p, "u_tex_size")
+	r.tilesUniform = gl.GetUniformLocation(p, "u_tiles_x")
+	r.palettesSampler = gl.GetUniformLocation(p, "u_palettes")
+	r.materialsSampler = gl.GetUniformLocation(p, "u_materials")
+	r.voxelsSampler = gl.GetUniformLocation(p, "u_voxels")
+
+	r.palettes.create()
+	r.voxelTextureID = gl.CreateTexture()
+	r.voxelData = make([]byte, raymarchSliceSize*SizeY)
+	r.uploaded = false
+
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_2D, r.voxelTextureID)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, raymarchTexWidth, raymarchTexHeight, gl.LUMINANCE_ALPHA, gl.UNSIGNED_BYTE, nil)
+	gl.ActiveTexture(gl.TEXTURE0)
+
+	// The bounding box of the view, the ray starts on its back faces.
+	var cube []byte
+	for _, indices := range facesIndices {
+		for _, i := range indices {
+			cube = append(cube,
+				cubeVertices[i*3]*SizeX,
+				cubeVertices[i*3+1]*SizeY,
+				cubeVertices[i*3+2]*SizeZ,
+				0)
+		}
+	}
+
+	r.cubeSize = len(cube) / 4
+	r.cubeBufferID = gl.CreateBuffer()
+	gl.BindBuffer(gl.ARRAY_BUFFER, r.cubeBufferID)
+	gl.BufferData(gl.ARRAY_BUFFER, cube, gl.STATIC_DRAW)
+	return nil
+}
+
+func (r *raymarchRenderer) destroy() {
+	gl.DeleteProgram(r.programID)
+	r.palettes.destroy()
+	gl.DeleteTexture(r.voxelTextureID)
+	gl.DeleteBuffer(r.cubeBufferID)
+}
+
+func (r *raymarchRenderer) setState(v *View) {
+	gl.Enable(gl.CULL_FACE)
+	gl.CullFace(gl.FRONT)
+	gl.Enable(gl.DEPTH_TEST)
+
+	// The shader outputs premultiplied alpha, the destination alpha is kept
+	// since it is used as the bloom mask.
+	gl.Enable(gl.BLEND)
+	gl.BlendFuncSeparate(gl.ONE, gl.ONE_MINUS_SRC_ALPHA, gl.ZERO, gl.ONE)
+
+	gl.UseProgram(r.programID)
+	gl.Uniform1i(r.palettesSampler, 0)
+	gl.Uniform1i(r.voxelsSampler, 2)
+	gl.Uniform1i(r.materialsSampler, 3)
+
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_2D, r.voxelTextureID)
+
+	r.palettes.bind()
+}
+
+func (r *raymarchRenderer) uploadPalettes(v *View) {
+	r.palettes.upload(v)
+}
+
+func (r *raymarchRenderer) uploadPalette(v *View, row int) {
+	r.palettes.uploadRow(v, row)
+}
+
+func (r *raymarchRenderer) setShadowQuality(v *View, q ShadowQuality) error {
+	if q != ShadowsOff {
+		return errors.New("shadows are not supported by the raymarch renderer")
+	}
+	return nil
+}
+
+func (r *raymarchRenderer) needsMesh() bool {
+	return false
+}
+
+// uploadVoxels updates the tiles of the slices that changed since the last
+// upload, the view is usually rewritten every frame but mostly unchanged.
+func (r *raymarchRenderer) uploadVoxels(v *View) {
+	gl.ActiveTexture(gl.TEXTURE2)
+	gl.BindTexture(gl.TEXTURE_2D, r.voxelTextureID)
+
+	for y := 0; y < SizeY; y++ {
+		slice := r.voxelData[y*raymarchSliceSize : (y+1)*raymarchSliceSize]
+		dirty := !r.uploaded
+
+		for z := 0; z < SizeZ; z++ {
+			dst := slice[z*SizeX*2:]
+			for x := 0; x < SizeX; x++ {
+				idx := offset(x, y, z)
+				c, pal := v.data[idx], v.paletteMap[v.paletteRows[idx]]
+				if dst[x*2] != c || dst[x*2+1] != pal {
+					dst[x*2], dst[x*2+1] = c, pal
+					dirty = true
+				}
+			}
+		}
+
+		if dirty {
+			tx, ty := y%raymarchTilesX, y/raymarchTilesX
+			gl.TexSubImage2D(gl.TEXTURE_2D, 0, tx*SizeX, ty*SizeZ, SizeX, SizeZ, gl.LUMINANCE_ALPHA, gl.UNSIGNED_BYTE, slice)
+		}
+	}
+
+	r.uploaded = true
+	gl.ActiveTexture(gl.TEXTURE0)
+}
+
+func (r *raymarchRenderer) render(v *View) error {
+	r.uploadVoxels(v)
+	r.setState(v)
+
+	mv := v.viewMatrix
+	mv.MultMatrix(&v.modelMatrix)
+
+	camera := cameraPosition(&mv)
+
+	gl.UniformMatrix4fv(r.mvpUniform, v.mvpMatrix.Slice())
+	gl.UniformMatrix4fv(r.mvUniform, mv.Slice())
+	gl.Uniform3fv(r.cameraUniform, camera.Slice())
+	gl.Uniform3f(r.sizeUniform, SizeX, SizeY, SizeZ)
+	gl.Uniform2f(r.texSizeUniform, raymarchTexWidth, raymarchTexHeight)
+	gl.Uniform1f(r.tilesUniform, raymarchTilesX)
+	r.lights.set(v, &mv)
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, r.cubeBufferID)
+	gl.VertexAttribPointer(r.positionAttrib, 4, gl.UNSIGNED_BYTE, false, 4, 0)
+	gl.EnableVertexAttribArray(r.positionAttrib)
+	gl.DrawArrays(gl.TRIANGLES, 0, r.cubeSize)
+
+	gl.CullFace(gl.BACK)
+	gl.Disable(gl.CULL_FACE)
+	gl.Disable(gl.BLEND)
+	return nil
+}
+
+var raymarchVertexShaderSrc = `
+	#version 120
+
+	uniform mat4 u_mvp;
+
+	attribute vec4 a_position;
+
+	varying vec3 v_position;
+
+	void main()
+	{
+		v_position = a_position.xyz;
+		gl_Position = u_mvp * vec4(a_position.xyz, 1.0);
+	}
+`
+
+var raymarchFragmentShaderSrc = `
+	#version 120
+
+	// GLES 2 can only write the depth with an extension. Without it the depth
+	// of the view bounds is used, which is less precise against sprites.
+	#ifdef GL_ES
+		#ifdef GL_EXT_frag_depth
+			#extension GL_EXT_frag_depth : enable
+			#define FRAG_DEPTH gl_FragDepthEXT
+		#endif
+	#else
+		#define FRAG_DEPTH gl_FragDepth
+	#endif
+
+	#define MAX_POINT_LIGHTS 4
+	#define MAX_STEPS 320
+
+	uniform mat4 u_mvp;
+	uniform mat4 u_mv;
+	uniform vec3 u_camera;
+	uniform vec3 u_size;
+	uniform vec2 u_tex_size;
+	uniform float u_tiles_x;
+
+	uniform sampler2D u_voxels;
+	uniform sampler2D u_palettes;
+	uniform sampler2D u_materials;
+
+	uniform vec3 u_ambient;
+	uniform vec3 u_light_dir;
+	uniform vec3 u_light_color;
+
+	uniform vec3 u_point_pos[MAX_POINT_LIGHTS];
+	uniform vec3 u_point_color[MAX_POINT_LIGHTS];
+	uniform float u_point_radius[MAX_POINT_LIGHTS];
+
+	varying vec3 v_position;
+
+	vec4 voxel(vec3 cell)
+	{
+		float tx = mod(cell.y, u_tiles_x);
+		float ty = floor(cell.y / u_tiles_x);
+		vec2 uv = vec2(tx * u_size.x + cell.x, ty * u_size.z + cell.z) + 0.5;
+		return texture2D(u_voxels, uv / u_tex_size);
+	}
+
+	vec3 lighting(vec3 position, vec3 normal)
+	{
+		vec3 light = u_ambient;
+		if (normal == vec3(0.0)) {
+			return light;
+		}
+
+		normal = normalize(mat3(u_mv) * normal);
+		light += max(dot(normal, u_light_dir), 0.0) * u_light_color;
+
+		for (int i = 0; i < MAX_POINT_LIGHTS; i++) {
+			if (u_point_radius[i] > 0.0) {
+				vec3 d = u_point_pos[i] - position;
+				float attenuation = max(1.0 - length(d) / u_point_radius[i], 0.0);
+				light += max(dot(normal, normalize(d)), 0.0) * attenuation * u_point_color[i];
+			}
+		}
+		return light;
+	}
+
+	void main()
+	{
+		vec3 dir = normalize(v_position - u_camera);
+		dir += vec3(equal(dir, vec3(0.0))) * 0.000001;
+		vec3 inv_dir = 1.0 / dir;
+
+		// Find where the ray enters the view volume.
+		vec3 t0 = -u_camera * inv_dir;
+		vec3 t1 = (u_size - u_camera) * inv_dir;
+		vec3 tmin = min(t0, t1);
+		float t = max(max(tmin.x, tmin.y), max(tmin.z, 0.0));
+
+		vec3 normal = vec3(0.0);
+		if (t > 0.0) {
+			if (t == tmin.x) {
+				normal = vec3(-sign(dir.x), 0.0, 0.0);
+			} else if (t == tmin.y) {
+				normal = vec3(0.0, -sign(dir.y), 0.0);
+			} else {
+				normal = vec3(0.0, 0.0, -sign(dir.z));
+			}
+		}
+
+		// Walk the grid one voxel at a time.
+		vec3 cell = clamp(floor(u_camera + dir * (t + 0.001)), vec3(0.0), u_size - 1.0);
+		vec3 step_dir = sign(dir);
+		vec3 tdelta = abs(inv_dir);
+		vec3 tmax = (cell + max(step_dir, 0.0) - u_camera) * inv_dir;
+
+		// Translucent voxels are accumulated front to back, runs of the same
+		// color are only counted once.
+		vec4 result = vec4(0.0);
+		float last = 0.0;
+		bool hit_any = false;
+
+		for (int i = 0; i < MAX_STEPS; i++) {
+			vec4 c = voxel(cell);
+			if (c.r > 0.0 && c.r != last) {
+				vec3 hit = u_camera + dir * t;
+				vec3 position = (u_mv * vec4(hit, 1.0)).xyz;
+				vec2 palette_coord = (vec2(c.r, c.a) * 255.0 + 0.5) / 256.0;
+				vec3 voxel_color = texture2D(u_palettes, palette_coord).xyz;
+				vec4 material = texture2D(u_materials, palette_coord);
+
+				// Emissive voxels bypass the lighting.
+				vec3 light = mix(lighting(position, normal), vec3(1.0), material.r);
+				result += (1.0 - result.a) * vec4(voxel_color * light, 1.0) * material.a;
+
+				if (!hit_any) {
+					#ifdef FRAG_DEPTH
+						vec4 clip = u_mvp * vec4(hit, 1.0);
+						FRAG_DEPTH = clip.z / clip.w * 0.5 + 0.5;
+					#endif
+					hit_any = true;
+				}
+
+				if (result.a >= 0.99) {
+					break;
+				}
+			}
+			last = c.r;
+
+			if (tmax.x < tmax.y && tmax.x < tmax.z) {
+				cell.x += step_dir.x;
+				t = tmax.x;
+				tmax.x += tdelta.x;
+				normal = vec3(-step_dir.x, 0.0, 0.0);
+			} else if (tmax.y < tmax.z) {
+				cell.y += step_dir.y;
+				t = tmax.y;
+				tmax.y += tdelta.y;
+				normal = vec3(0.0, -step_dir.y, 0.0);
+			} else {
+				cell.z += step_dir.z;
+				t = tmax.z;
+				tmax.z += tdelta.z;
+				normal = vec3(0.0, 0.0, -step_dir.z);
+			}
+
+			if (any(lessThan(cell, vec3(0.0))) || any(greaterThanEqual(cell, u_size))) {
+				break;
+			}
+		}
+
+		if (!hit_any) {
+			discard;
+		}
+		gl_FragColor = result;
+	}
+`
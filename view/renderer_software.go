@@ -0,0 +1,264 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package view
+
+import (
+	"errors"
+	"image"
+	"image/color"
+
+	"github.com/barnex/fmath"
+	"github.com/ungerik/go3d/mat4"
+	"github.com/ungerik/go3d/vec3"
+)
+
+// SoftwareRenderer rasterizes the view on the CPU in to an image. It needs
+// no GPU and is used for screenshots and golden image tests. It produces the
+// same lighting as the OpenGL renderer but does not support shadows.
+type SoftwareRenderer struct {
+	ClearColor color.RGBA
+
+	img   *image.RGBA
+	depth []float32
+}
+
+type rasterVertex struct {
+	x, y, z float32
+	color   vec3.T
+	alpha   float32
+}
+
+func NewSoftwareRenderer(width, height int) *SoftwareRenderer {
+	return &SoftwareRenderer{
+		ClearColor: color.RGBA{A: 255},
+		img:        image.NewRGBA(image.Rect(0, 0, width, height)),
+		depth:      make([]float32, width*height),
+	}
+}
+
+// Image returns the result of the last Render call.
+func (r *SoftwareRenderer) Image() *image.RGBA {
+	return r.img
+}
+
+func (r *SoftwareRenderer) init(v *View) error {
+	return nil
+}
+
+func (r *SoftwareRenderer) destroy() {
+}
+
+func (r *SoftwareRenderer) setState(v *View) {
+}
+
+func (r *SoftwareRenderer) uploadPalettes(v *View) {
+}
+
+func (r *SoftwareRenderer) uploadPalette(v *View, row int) {
+}
+
+func (r *SoftwareRenderer) setShadowQuality(v *View, q ShadowQuality) error {
+	if q != ShadowsOff {
+		return errors.New("shadows are not supported by the software renderer")
+	}
+	return nil
+}
+
+func (r *SoftwareRenderer) needsMesh() bool {
+	return true
+}
+
+func (r *SoftwareRenderer) clear() {
+	pix := r.img.Pix
+	for i := 0; i < len(pix); i += 4 {
+		pix[i] = r.ClearColor.R
+		pix[i+1] = r.ClearColor.G
+		pix[i+2] = r.ClearColor.B
+		pix[i+3] = r.ClearColor.A
+	}
+
+	for i := range r.depth {
+		r.depth[i] = 1
+	}
+}
+
+func (r *SoftwareRenderer) render(v *View) error {
+	r.clear()
+
+	mv := v.viewMatrix
+	mv.MultMatrix(&v.modelMatrix)
+	sunDir, pointPos := v.eyeSpaceLights(&mv)
+
+	for _, b := range v.buffers {
+		if b.visible {
+			r.renderBuffer(v, b, &mv, &sunDir, &pointPos, false)
+		}
+	}
+
+	// Translucent faces are sorted back to front and blended without
+	// writing depth.
+	r.renderBuffer(v, v.transparent, &mv, &sunDir, &pointPos, true)
+	return nil
+}
+
+func (r *SoftwareRenderer) renderBuffer(v *View, b *faceBuffer, mv *mat4.T, sunDir *vec3.T, pointPos *[maxPointLights]vec3.T, blend bool) {
+	size := r.img.Bounds().Size()
+	w, h := float32(size.X), float32(size.Y)
+
+	const triangleSize = 3 * vertexSize
+	for i := 0; i+triangleSize <= len(b.vertexBuffer); i += triangleSize {
+		var (
+			tri     [3]rasterVertex
+			clipped bool
+		)
+
+		for j := range tri {
+			vtx := b.vertexBuffer[i+j*vertexSize : i+(j+1)*vertexSize]
+			p := vec3.T{float32(vtx[0]), float32(vtx[1]), float32(vtx[2])}
+
+			cw := clipW(&v.mvpMatrix, &p)
+			if cw <= 0 {
+				clipped = true
+				break
+			}
+
+			ndc := transformVec3(&v.mvpMatrix, &p, 1)
+			ndc.Scale(1 / cw)
+
+			normal := unpackNormal(vtx[6])
+			normal = transformVec3(mv, &normal, 0)
+			normal.Normalize()
+
+			eyePos := transformVec3(mv, &p, 1)
+			light := v.vertexLight(&eyePos, &normal, vtx[4], sunDir, pointPos)
+
+			// Emissive voxels bypass the lighting.
+			m := v.Material(vtx[5], vtx[3])
+			for k := range light {
+				light[k] += (1 - light[k]) * m.Emission
+			}
+
+			c := v.paletteColor(vtx[5], vtx[3])
+			tri[j] = rasterVertex{
+				x:     (ndc[0] + 1) * 0.5 * w,
+				y:     (1 - ndc[1]) * 0.5 * h,
+				z:     ndc[2],
+				color: vec3.T{c[0] * light[0], c[1] * light[1], c[2] * light[2]},
+				alpha: 1 - m.Transparency,
+			}
+		}
+
+		// Triangles crossing the near plane are rejected instead of clipped,
+		// voxels are small enough for this to not be noticeable.
+		if !clipped {
+			r.rasterize(&tri, blend)
+		}
+	}
+}
+
+func (r *SoftwareRenderer) rasterize(t *[3]rasterVertex, blend bool) {
+	v0, v1, v2 := &t[0], &t[1], &t[2]
+
+	area := edge(v0, v1, v2.x, v2.y)
+	if area == 0 {
+		return
+	}
+
+	size := r.img.Bounds().Size()
+	minX := clampInt(int(fmath.Floor(fmath.Min(v0.x, fmath.Min(v1.x, v2.x)))), 0, size.X-1)
+	minY := clampInt(int(fmath.Floor(fmath.Min(v0.y, fmath.Min(v1.y, v2.y)))), 0, size.Y-1)
+	maxX := clampInt(int(fmath.Ceil(fmath.Max(v0.x, fmath.Max(v1.x, v2.x)))), 0, size.X-1)
+	maxY := clampInt(int(fmath.Ceil(fmath.Max(v0.y, fmath.Max(v1.y, v2.y)))), 0, size.Y-1)
+
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			px, py := float32(x)+0.5, float32(y)+0.5
+
+			w0 := edge(v1, v2, px, py) / area
+			w1 := edge(v2, v0, px, py) / area
+			w2 := edge(v0, v1, px, py) / area
+			if w0 < 0 || w1 < 0 || w2 < 0 {
+				continue
+			}
+
+			z := w0*v0.z + w1*v1.z + w2*v2.z
+			idx := y*size.X + x
+			if z < -1 || z >= r.depth[idx] {
+				continue
+			}
+
+			alpha := float32(1)
+			if blend {
+				alpha = w0*v0.alpha + w1*v1.alpha + w2*v2.alpha
+			} else {
+				r.depth[idx] = z
+			}
+
+			pix := r.img.Pix[y*r.img.Stride+x*4:]
+			for i := 0; i < 3; i++ {
+				c := fmath.Min(fmath.Max(w0*v0.color[i]+w1*v1.color[i]+w2*v2.color[i], 0), 1) * 255
+				pix[i] = uint8(c*alpha + float32(pix[i])*(1-alpha))
+			}
+			pix[3] = 255
+		}
+	}
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// edge returns the signed area of the parallelogram spanned by a->b and a->p.
+func edge(a, b *rasterVertex, px, py float32) float32 {
+	return (b.x-a.x)*(py-a.y) - (b.y-a.y)*(px-a.x)
+}
+
+// clipW returns the w component of m multiplied with the point p.
+func clipW(m *mat4.T, p *vec3.T) float32 {
+	a := m.Array()
+	return a[3]*p[0] + a[7]*p[1] + a[11]*p[2] + a[15]
+}
+
+// paletteColor returns the color of index in palette row.
+func (v *View) paletteColor(row, index uint8) vec3.T {
+	idx := (int(row)*paletteSize + int(index)) * 3
+	c := v.paletteData[idx : idx+3]
+	return vec3.T{float32(c[0]) / 255, float32(c[1]) / 255, float32(c[2]) / 255}
+}
+
+// vertexLight mirrors the lighting in the voxel vertex shader.
+func (v *View) vertexLight(pos, normal *vec3.T, ao uint8, sunDir *vec3.T, pointPos *[maxPointLights]vec3.T) vec3.T {
+	occlusion := 1 - v.aoStrength*(1-float32(ao)/3)
+	light := v.ambient.Scaled(occlusion)
+
+	sun := v.sun.Color.Scaled(fmath.Max(vec3.Dot(normal, sunDir), 0))
+	light.Add(&sun)
+
+	for i, l := range v.pointLights {
+		if l.Radius <= 0 {
+			continue
+		}
+
+		d := vec3.Sub(&pointPos[i], pos)
+		dist := d.Length()
+		if dist == 0 {
+			continue
+		}
+
+		attenuation := fmath.Max(1-dist/l.Radius, 0)
+		d.Scale(1 / dist)
+
+		c := l.Color.Scaled(fmath.Max(vec3.Dot(normal, &d), 0) * attenuation)
+		light.Add(&c)
+	}
+	return light
+}
@@ -0,0 +1,269 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package view
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/barnex/fmath"
+	"github.com/goxjs/gl"
+	"github.com/goxjs/gl/glutil"
+	"github.com/ungerik/go3d/mat4"
+	"github.com/ungerik/go3d/vec3"
+)
+
+type ShadowQuality int
+
+const (
+	ShadowsOff ShadowQuality = iota
+	ShadowsLow
+	ShadowsMedium
+	ShadowsHigh
+)
+
+const defaultShadowBias = 0.002
+
+var shadowQualitySettings = map[ShadowQuality]struct {
+	size, pcfRadius int
+}{
+	ShadowsLow:    {512, 0},
+	ShadowsMedium: {1024, 1},
+	ShadowsHigh:   {2048, 2},
+}
+
+// shadowMap holds the light's depth, packed in to RGBA since GLES 2 does not
+// guarantee depth textures.
+type shadowMap struct {
+	quality   ShadowQuality
+	size      int
+	pcfRadius int
+
+	textureID      gl.Texture
+	depthBufferID  gl.Renderbuffer
+	framebufferID  gl.Framebuffer
+	depthProgramID gl.Program
+	positionAttrib gl.Attrib
+	mvpUniform     gl.Uniform
+
+	mvpMatrix mat4.T
+}
+
+func (s *shadowMap) enabled() bool {
+	return s.quality != ShadowsOff
+}
+
+func (s *shadowMap) defines() string {
+	if !s.enabled() {
+		return ""
+	}
+	return fmt.Sprintf("#define SHADOWS\n#define PCF_RADIUS %d\n", s.pcfRadius)
+}
+
+// create allocates the shadow map. The quality is only set once the map is
+// complete, on failure everything created is destroyed and shadows stay off.
+func (s *shadowMap) create(q ShadowQuality) error {
+	settings, ok := shadowQualitySettings[q]
+	if !ok {
+		return fmt.Errorf("invalid shadow quality: %d", q)
+	}
+
+	s.size = settings.size
+	s.pcfRadius = settings.pcfRadius
+
+	var err error
+	s.depthProgramID, err = glutil.CreateProgram(depthVertexShaderSrc, depthFragmentShaderSrc)
+	if err != nil {
+		s.destroy()
+		return err
+	}
+
+	s.positionAttrib = gl.GetAttribLocation(s.depthProgramID, "a_position")
+	s.mvpUniform = gl.GetUniformLocation(s.depthProgramID, "u_mvp")
+
+	s.textureID = gl.CreateTexture()
+	gl.BindTexture(gl.TEXTURE_2D, s.textureID)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	gl.TexImage2D(gl.TEXTURE_2D, 0, s.size, s.size, gl.RGBA, gl.UNSIGNED_BYTE, nil)
+
+	s.depthBufferID = gl.CreateRenderbuffer()
+	gl.BindRenderbuffer(gl.RENDERBUFFER, s.depthBufferID)
+	gl.RenderbufferStorage(gl.RENDERBUFFER, gl.DEPTH_COMPONENT16, s.size, s.size)
+
+	s.framebufferID = gl.CreateFramebuffer()
+	gl.BindFramebuffer(gl.FRAMEBUFFER, s.framebufferID)
+	gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, s.textureID, 0)
+	gl.FramebufferRenderbuffer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.RENDERBUFFER, s.depthBufferID)
+
+	status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, gl.Framebuffer{})
+
+	if status != gl.FRAMEBUFFER_COMPLETE {
+		s.destroy()
+		return errors.New("incomplete shadow map framebuffer")
+	}
+
+	s.quality = q
+	return nil
+}
+
+// destroy deletes the objects that were created and turns shadows off.
+func (s *shadowMap) destroy() {
+	if s.framebufferID.Valid() {
+		gl.DeleteFramebuffer(s.framebufferID)
+	}
+	if s.depthBufferID.Valid() {
+		gl.DeleteRenderbuffer(s.depthBufferID)
+	}
+	if s.textureID.Valid() {
+		gl.DeleteTexture(s.textureID)
+	}
+	if s.depthProgramID.Valid() {
+		gl.DeleteProgram(s.depthProgramID)
+	}
+	*s = shadowMap{}
+}
+
+// updateMatrix fits an orthographic light projection around the view volume.
+// The view's model matrix is a translation so model space shares orientation
+// with world space.
+func (s *shadowMap) updateMatrix(dir vec3.T) {
+	dir.Normalize()
+
+	center := vec3.T{SizeX / 2, SizeY / 2, SizeZ / 2}
+	radius := fmath.Sqrt(SizeX*SizeX+SizeY*SizeY+SizeZ*SizeZ) / 2
+
+	eye := dir.Scaled(radius)
+	eye.Add(&center)
+
+	up := vec3.T{0, 1, 0}
+	if fmath.Abs(dir[1]) > 0.99 {
+		up = vec3.T{0, 0, 1}
+	}
+
+	var viewMatrix mat4.T
+	lookAt(&viewMatrix, &eye, &center, &up)
+
+	orthographic(&s.mvpMatrix, -radius, radius, -radius, radius, 0, radius*2)
+	s.mvpMatrix.MultMatrix(&viewMatrix)
+}
+
+func (v *View) SetShadowQuality(q ShadowQuality) error {
+	if q == v.shadowQuality {
+		return nil
+	}
+
+	if err := v.renderer.setShadowQuality(v, q); err != nil {
+		v.shadowQuality = ShadowsOff
+		return err
+	}
+	v.shadowQuality = q
+	return nil
+}
+
+func (v *View) ShadowQuality() ShadowQuality {
+	return v.shadowQuality
+}
+
+// SetShadowBias sets the depth offset used to avoid shadow acne.
+func (v *View) SetShadowBias(bias float32) {
+	v.shadowBias = bias
+}
+
+func (r *glRenderer) renderShadowMap(v *View) {
+	s := &r.shadow
+	s.updateMatrix(v.sun.Direction)
+
+	var (
+		viewport   [4]int32
+		clearColor [4]float32
+	)
+	gl.GetIntegerv(gl.VIEWPORT, viewport[:])
+	gl.GetFloatv(clearColor[:], gl.COLOR_CLEAR_VALUE)
+
+	// The scene may be rendered to a texture for post processing.
+	target := gl.GetBoundFramebuffer()
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, s.framebufferID)
+	gl.Viewport(0, 0, s.size, s.size)
+	gl.ClearColor(1, 1, 1, 1)
+	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+
+	gl.UseProgram(s.depthProgramID)
+	gl.UniformMatrix4fv(s.mvpUniform, s.mvpMatrix.Slice())
+
+	for _, b := range v.buffers {
+		if b.lit {
+			r.draw(b, s.positionAttrib)
+		}
+	}
+
+	gl.BindFramebuffer(gl.FRAMEBUFFER, target)
+	gl.Viewport(int(viewport[0]), int(viewport[1]), int(viewport[2]), int(viewport[3]))
+	gl.ClearColor(clearColor[0], clearColor[1], clearColor[2], clearColor[3])
+}
+
+func lookAt(m *mat4.T, eye, center, up *vec3.T) {
+	f := vec3.Sub(center, eye)
+	f.Normalize()
+	s := vec3.Cross(&f, up)
+	s.Normalize()
+	u := vec3.Cross(&s, &f)
+
+	*m = mat4.Ident
+	a := m.Array()
+	a[0], a[4], a[8] = s[0], s[1], s[2]
+	a[1], a[5], a[9] = u[0], u[1], u[2]
+	a[2], a[6], a[10] = -f[0], -f[1], -f[2]
+	a[12] = -vec3.Dot(&s, eye)
+	a[13] = -vec3.Dot(&u, eye)
+	a[14] = vec3.Dot(&f, eye)
+}
+
+func orthographic(m *mat4.T, left, right, bottom, top, near, far float32) {
+	*m = mat4.Ident
+	a := m.Array()
+	a[0] = 2 / (right - left)
+	a[5] = 2 / (top - bottom)
+	a[10] = -2 / (far - near)
+	a[12] = -(right + left) / (right - left)
+	a[13] = -(top + bottom) / (top - bottom)
+	a[14] = -(far + near) / (far - near)
+}
+
+var depthVertexShaderSrc = `
+	#version 120
+
+	uniform mat4 u_mvp;
+
+	attribute vec4 a_position;
+
+	void main()
+	{
+		gl_Position = u_mvp * vec4(a_position.xyz, 1.0);
+	}
+`
+
+var depthFragmentShaderSrc = `
+	#version 120
+
+	vec4 pack_depth(float depth)
+	{
+		const vec4 shift = vec4(256.0 * 256.0 * 256.0, 256.0 * 256.0, 256.0, 1.0);
+		const vec4 mask = vec4(0.0, 1.0 / 256.0, 1.0 / 256.0, 1.0 / 256.0);
+
+		vec4 c = fract(depth * shift);
+		return c - c.xxyz * mask;
+	}
+
+	void main()
+	{
+		gl_FragColor = pack_depth(gl_FragCoord.z);
+	}
+`
@@ -12,8 +12,6 @@ import (
 
 	"github.com/andreas-jonsson/voxel/voxel"
 	"github.com/barnex/fmath"
-	"github.com/goxjs/gl"
-	"github.com/goxjs/gl/glutil"
 	"github.com/ungerik/go3d/mat4"
 	"github.com/ungerik/go3d/vec3"
 )
@@ -31,6 +29,13 @@ const (
 	nBuffers             = 1
 )
 
+const (
+	vertexSize     = 8
+	maxPointLights = 4
+	maxPalettes    = 256
+	paletteSize    = 256
+)
+
 var (
 	cubeVertices = [24]byte{
 		// front
@@ -103,148 +108,297 @@ const (
 	rightFace
 	frontFace
 	backFace
+
+	// transparentFaces is not a face, it names the buffer holding the
+	// translucent faces of all directions.
+	transparentFaces
 )
 
 type faceBuffer struct {
-	vertexBuffer    []byte
-	vertexBufferIDs [nBuffers]gl.Buffer
-	bufferCount     uint32
-	indices         [6]int
-	normal          vec3.T
-	face            faceName
+	vertexBuffer []byte
+	normal       vec3.T
+	face         faceName
+
+	// uploaded is cleared when the buffer is rebuilt and set by renderers
+	// that keep a copy of the vertex data.
+	uploaded bool
+
+	// visible is set if the face can be seen from the camera and lit if
+	// it faces the shadow casting light.
+	visible, lit bool
 }
 
 func newFaceBuffer(face faceName) *faceBuffer {
-	var buffers [nBuffers]gl.Buffer
-	for i := range buffers {
-		buffers[i] = gl.CreateBuffer()
-	}
-
-	return &faceBuffer{
-		vertexBufferIDs: buffers,
-		indices:         facesIndices[face],
-		normal:          facesNormals[face],
-		face:            face,
+	b := &faceBuffer{face: face}
+	if face < transparentFaces {
+		b.normal = facesNormals[face]
 	}
+	return b
 }
 
 func (b *faceBuffer) reset() {
 	b.vertexBuffer = b.vertexBuffer[:0]
+	b.uploaded = false
 }
 
-func (b *faceBuffer) append(x, y, z, color byte) {
+// append adds the face of the size^3 voxel block at x,y,z to the buffer. The
+// ao array holds the occlusion level (0-3, where 3 is unoccluded) for each
+// cube vertex.
+func (b *faceBuffer) append(face faceName, x, y, z, size, color, palette byte, ao *[8]byte) {
+	indices := &facesIndices[face]
+	normal := packNormal(&facesNormals[face])
+
+	// Flip the quad diagonal to avoid anisotropic interpolation of the occlusion.
+	if int(ao[indices[0]])+int(ao[indices[2]]) < int(ao[indices[1]])+int(ao[indices[4]]) {
+		indices = &[6]int{
+			indices[1], indices[2], indices[4],
+			indices[4], indices[0], indices[1],
+		}
+	}
+
 	for i := 0; i < 6; i++ {
-		index := b.indices[i] * 3
-		b.vertexBuffer = append(b.vertexBuffer, cubeVertices[index]+x)
-		b.vertexBuffer = append(b.vertexBuffer, cubeVertices[index+1]+y)
-		b.vertexBuffer = append(b.vertexBuffer, cubeVertices[index+2]+z)
+		vi := indices[i]
+		index := vi * 3
+		b.vertexBuffer = append(b.vertexBuffer, cubeVertices[index]*size+x)
+		b.vertexBuffer = append(b.vertexBuffer, cubeVertices[index+1]*size+y)
+		b.vertexBuffer = append(b.vertexBuffer, cubeVertices[index+2]*size+z)
 		b.vertexBuffer = append(b.vertexBuffer, color)
+		b.vertexBuffer = append(b.vertexBuffer, ao[vi], palette, normal, 0)
 	}
 }
 
-func (b *faceBuffer) draw(location gl.Attrib) {
-	if len(b.vertexBuffer) > 0 {
-		gl.BindBuffer(gl.ARRAY_BUFFER, b.vertexBufferIDs[b.bufferCount%nBuffers])
-		gl.BufferData(gl.ARRAY_BUFFER, b.vertexBuffer, gl.STREAM_DRAW)
-
-		gl.VertexAttribPointer(location, 4, gl.UNSIGNED_BYTE, false, 0, 0)
-		gl.EnableVertexAttribArray(location)
+// packNormal stores an axis aligned normal in a byte, each component
+// biased to 0-2 in base 3.
+func packNormal(n *vec3.T) byte {
+	return byte(n[0]+1) + byte(n[1]+1)*3 + byte(n[2]+1)*9
+}
 
-		gl.DrawArrays(gl.TRIANGLES, 0, len(b.vertexBuffer)/4)
-		b.bufferCount++
-	}
+func unpackNormal(p byte) vec3.T {
+	return vec3.T{float32(p%3) - 1, float32(p/3%3) - 1, float32(p/9) - 1}
 }
 
 func offset(x, y, z int) int {
 	return z*SizeX*SizeY + y*SizeX + x
 }
 
+// DirectionalLight is a light infinitely far away. Direction points towards
+// the light, in world space.
+type DirectionalLight struct {
+	Direction vec3.T
+	Color     vec3.T
+}
+
+// PointLight is a light at Position, in view voxel space, that fades out
+// linearly towards Radius.
+type PointLight struct {
+	Position vec3.T
+	Color    vec3.T
+	Radius   float32
+}
+
+// Renderer draws the face buffers built by a view. The default renderer uses
+// OpenGL, see ConfigWithRenderer.
+type Renderer interface {
+	init(v *View) error
+	destroy()
+	setState(v *View)
+	uploadPalettes(v *View)
+	uploadPalette(v *View, row int)
+	setShadowQuality(v *View, q ShadowQuality) error
+	render(v *View) error
+
+	// needsMesh is false for renderers that draw the voxel data directly,
+	// BuildBuffers then skips building the face buffers.
+	needsMesh() bool
+}
+
+type Config func(*View) error
+
+func ConfigWithRenderer(r Renderer) Config {
+	return func(v *View) error {
+		v.renderer = r
+		return nil
+	}
+}
+
 type View struct {
-	paletteData      []byte
-	paletteTextureID gl.Texture
-	buffers          [6]*faceBuffer
-	data             []uint8
+	renderer     Renderer
+	paletteData  []byte
+	materialData []byte
+	buffers      [6]*faceBuffer
+	data         []uint8
+
+	transparent     *faceBuffer
+	transparentSort quadsByDepth
+
+	// paletteRows holds the palette of each voxel in data, paletteRow is
+	// the palette assigned by Set and paletteMap remaps palettes at render time.
+	paletteRows []uint8
+	paletteRow  uint8
+	paletteMap  [maxPalettes]uint8
 
 	mvpMatrix,
 	modelMatrix,
 	viewMatrix mat4.T
 
-	voxelProgramID gl.Program
-	positionAttrib gl.Attrib
-	normalUniform,
-	palettesSampler gl.Uniform
+	ambient     vec3.T
+	aoStrength  float32
+	sun         DirectionalLight
+	pointLights []PointLight
+
+	shadowQuality ShadowQuality
+	shadowBias    float32
+
+	// lodDistances holds the camera distance where each level of detail
+	// starts, chunkLODs the current level of each chunk.
+	lodDistances []float32
+	chunkLODs    []uint8
 }
 
-func NewView() (*View, error) {
+func NewView(configs ...Config) (*View, error) {
 	v := &View{
-		paletteTextureID: gl.CreateTexture(),
-		modelMatrix:      mat4.Ident,
-		data:             make([]uint8, SizeX*SizeY*SizeZ),
+		modelMatrix:  mat4.Ident,
+		data:         make([]uint8, SizeX*SizeY*SizeZ),
+		paletteRows:  make([]uint8, SizeX*SizeY*SizeZ),
+		paletteData:  make([]byte, maxPalettes*paletteSize*3),
+		materialData: make([]byte, maxPalettes*paletteSize*materialSize),
+		ambient:      vec3.T{0.6, 0.6, 0.6},
+		aoStrength:   0.5,
+		sun: DirectionalLight{
+			Direction: vec3.T{-1, 1, -1},
+			Color:     vec3.T{0.6, 0.6, 0.6},
+		},
+		shadowBias: defaultShadowBias,
 	}
 
-	m := &v.modelMatrix
-	m.TranslateX(-SizeX / 2)
-	m.TranslateZ(-SizeZ / 2)
+	for _, cfg := range configs {
+		if err := cfg(v); err != nil {
+			return nil, err
+		}
+	}
 
-	var err error
-	v.voxelProgramID, err = glutil.CreateProgram(vertexShaderSrc, fragmentShaderSrc)
-	if err != nil {
-		return nil, err
+	if v.renderer == nil {
+		v.renderer = &glRenderer{}
 	}
 
-	v.positionAttrib = gl.GetAttribLocation(v.voxelProgramID, "a_position")
-	v.normalUniform = gl.GetUniformLocation(v.voxelProgramID, "u_normal")
-	v.palettesSampler = gl.GetUniformLocation(v.voxelProgramID, "u_palettes")
+	for i := range v.paletteMap {
+		v.paletteMap[i] = uint8(i)
+		v.resetMaterials(i)
+	}
+
+	m := &v.modelMatrix
+	m.TranslateX(-SizeX / 2)
+	m.TranslateZ(-SizeZ / 2)
 
 	for i := range v.buffers {
 		v.buffers[i] = newFaceBuffer(faceName(i))
 	}
+	v.transparent = newFaceBuffer(transparentFaces)
+
+	if err := v.renderer.init(v); err != nil {
+		return nil, err
+	}
 	return v, nil
 }
 
 func (v *View) Destroy() {
-	gl.DeleteProgram(v.voxelProgramID)
-	gl.DeleteTexture(v.paletteTextureID)
-
-	for i := range v.buffers {
-		for _, id := range v.buffers[i].vertexBufferIDs {
-			gl.DeleteBuffer(id)
-		}
-	}
+	v.renderer.destroy()
 }
 
 func (v *View) Data() []uint8 {
 	return v.data
 }
 
+// PaletteData returns the palette row of each voxel, laid out like Data.
+func (v *View) PaletteData() []uint8 {
+	return v.paletteRows
+}
+
+// SetPaletteRow selects the palette used by voxels written with Set.
+func (v *View) SetPaletteRow(row uint8) {
+	v.paletteRow = row
+}
+
+func (v *View) PaletteRow() uint8 {
+	return v.paletteRow
+}
+
+// MapPalette renders voxels using palette row with palette to instead. This
+// allows palettes to be swapped, for day and night or damage tints, without
+// touching the voxel data.
+func (v *View) MapPalette(row, to uint8) {
+	v.paletteMap[row] = to
+}
+
+// SetGLState prepares the renderer for drawing the view. It is called
+// SetGLState for historical reasons, all renderers implement it.
 func (v *View) SetGLState() {
-	gl.Disable(gl.CULL_FACE)
-	gl.Disable(gl.BLEND)
-	gl.Enable(gl.DEPTH_TEST)
+	v.renderer.setState(v)
+}
 
-	gl.UseProgram(v.voxelProgramID)
-	gl.Uniform1i(v.palettesSampler, 0)
+// SetAmbient sets the ambient light color.
+func (v *View) SetAmbient(c vec3.T) {
+	v.ambient = c
+}
 
-	gl.ActiveTexture(gl.TEXTURE0)
-	gl.BindTexture(gl.TEXTURE_2D, v.paletteTextureID)
+// SetAmbientOcclusion sets how much fully occluded vertices are darkened,
+// 0 disables ambient occlusion and 1 makes them black.
+func (v *View) SetAmbientOcclusion(strength float32) {
+	v.aoStrength = strength
 }
 
+func (v *View) SetDirectionalLight(light DirectionalLight) {
+	v.sun = light
+}
+
+// SetPointLights replaces the point lights. Only the first maxPointLights
+// lights are used.
+func (v *View) SetPointLights(lights ...PointLight) {
+	if len(lights) > maxPointLights {
+		lights = lights[:maxPointLights]
+	}
+	v.pointLights = append(v.pointLights[:0], lights...)
+}
+
+// SetPalettes replaces all palettes, palette i is stored in row i.
 func (v *View) SetPalettes(palettes ...color.Palette) {
-	v.paletteData = make([]byte, 256*256*3)
+	for i := range v.paletteData {
+		v.paletteData[i] = 0
+	}
 
 	for i, pal := range palettes {
-		for j, c := range pal {
-			r, g, b, _ := c.RGBA()
-			idx := i*256 + j*3
-			v.paletteData[idx] = byte(r)
-			v.paletteData[idx+1] = byte(g)
-			v.paletteData[idx+2] = byte(b)
+		if i >= maxPalettes {
+			break
 		}
+		v.writePalette(i, pal)
 	}
 
-	v.SetGLState()
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
-	gl.TexImage2D(gl.TEXTURE_2D, 0, 256, 256, gl.RGB, gl.UNSIGNED_BYTE, v.paletteData)
+	v.renderer.uploadPalettes(v)
+}
+
+// SetPalette replaces the palette in row.
+func (v *View) SetPalette(row uint8, pal color.Palette) {
+	v.writePalette(int(row), pal)
+	v.renderer.uploadPalette(v, int(row))
+}
+
+func (v *View) writePalette(row int, pal color.Palette) {
+	data := v.paletteData[row*paletteSize*3 : (row+1)*paletteSize*3]
+	for i := range data {
+		data[i] = 0
+	}
+
+	for i, c := range pal {
+		if i >= paletteSize {
+			break
+		}
+
+		r, g, b, _ := c.RGBA()
+		idx := i * 3
+		data[idx] = byte(r >> 8)
+		data[idx+1] = byte(g >> 8)
+		data[idx+2] = byte(b >> 8)
+	}
 }
 
 func (v *View) Bounds() voxel.Box {
@@ -252,7 +406,9 @@ func (v *View) Bounds() voxel.Box {
 }
 
 func (v *View) Set(x, y, z int, index uint8) {
-	v.data[offset(x, y, z)] = index
+	idx := offset(x, y, z)
+	v.data[idx] = index
+	v.paletteRows[idx] = v.paletteRow
 }
 
 func (v *View) Get(x, y, z int) uint8 {
@@ -268,22 +424,37 @@ func (v *View) BuildBuffers(proj, view *mat4.T) {
 	v.mvpMatrix = *proj
 	v.mvpMatrix.MultMatrix(&modelViewMatrix)
 
+	if !v.renderer.needsMesh() {
+		return
+	}
+
 	m := modelViewMatrix.Array()
 	forward := vec3.T{-m[2], -m[6], -m[10]}
 
+	lightDir := v.sun.Direction
+	lightDir.Normalize()
+
 	var visibleBuffers []*faceBuffer
 	for _, b := range v.buffers {
 		b.reset()
 
 		angel := fmath.Acos(vec3.Dot(&b.normal, &forward)) / math.Pi * 180
-		if !cullBackface || angel > cullAngel {
+		b.visible = !cullBackface || angel > cullAngel
+		b.lit = v.shadowQuality != ShadowsOff && vec3.Dot(&b.normal, &lightDir) > 0
+
+		if b.visible || b.lit {
 			visibleBuffers = append(visibleBuffers, b)
 		}
 	}
 
+	v.transparent.reset()
+	v.transparent.visible = true
+
 	//log.Println("Number of visible faces:", len(visibleBuffers))
 
-	if threadedBufferBuilds {
+	if len(v.lodDistances) > 0 {
+		v.buildLODBuffers(visibleBuffers, cameraPosition(&modelViewMatrix))
+	} else if threadedBufferBuilds {
 		var wg sync.WaitGroup
 		wg.Add(len(visibleBuffers))
 
@@ -292,13 +463,9 @@ func (v *View) BuildBuffers(proj, view *mat4.T) {
 				for z := 0; z < SizeZ; z++ {
 					for y := 0; y < SizeY; y++ {
 						for x := 0; x < SizeX; x++ {
-							c := v.Get(x, y, z)
-							if c == 0 {
-								continue
-							}
-
-							if v.isFaceExposed(x, y, z, b.normal) {
-								b.append(byte(x), byte(y), byte(z), c)
+							idx := offset(x, y, z)
+							if v.data[idx] != 0 && !v.isTranslucent(idx) {
+								v.appendFace(b, b, x, y, z, idx)
 							}
 						}
 					}
@@ -308,115 +475,185 @@ func (v *View) BuildBuffers(proj, view *mat4.T) {
 		}
 
 		wg.Wait()
-	} else {
+
+		// The transparent buffer is shared by all directions.
 		for z := 0; z < SizeZ; z++ {
 			for y := 0; y < SizeY; y++ {
 				for x := 0; x < SizeX; x++ {
-					c := v.Get(x, y, z)
-					if c == 0 {
-						continue
-					}
-
-					for _, b := range visibleBuffers {
-						if v.isFaceExposed(x, y, z, b.normal) {
-							b.append(byte(x), byte(y), byte(z), c)
+					idx := offset(x, y, z)
+					if v.data[idx] != 0 && v.isTranslucent(idx) {
+						for _, b := range visibleBuffers {
+							if b.visible {
+								v.appendFace(v.transparent, b, x, y, z, idx)
+							}
 						}
 					}
 				}
 			}
 		}
+	} else {
+		for z := 0; z < SizeZ; z++ {
+			for y := 0; y < SizeY; y++ {
+				for x := 0; x < SizeX; x++ {
+					v.appendVoxel(visibleBuffers, x, y, z)
+				}
+			}
+		}
 	}
-}
 
-func (v *View) isFaceExposed(x, y, z int, n vec3.T) bool {
-	x += int(n[0])
-	y += int(n[1])
-	z += int(n[2])
+	v.sortTransparent(v.transparent, &modelViewMatrix)
+}
 
-	if x < 0 || y < 0 || z < 0 || x >= SizeX || y >= SizeY || z >= SizeZ {
-		return true
+// appendVoxel adds the exposed faces of voxel x,y,z to buffers, or to the
+// transparent buffer if it is translucent.
+func (v *View) appendVoxel(buffers []*faceBuffer, x, y, z int) {
+	idx := offset(x, y, z)
+	if v.data[idx] == 0 {
+		return
 	}
-	return v.Get(x, y, z) == 0
-}
 
-func (v *View) Clear(c byte) {
-	for z := 0; z < SizeZ; z++ {
-		for y := 0; y < SizeY; y++ {
-			for x := 0; x < SizeX; x++ {
-				v.data[offset(x, y, z)] = c
+	if v.isTranslucent(idx) {
+		for _, b := range buffers {
+			if b.visible {
+				v.appendFace(v.transparent, b, x, y, z, idx)
 			}
 		}
+	} else {
+		for _, b := range buffers {
+			v.appendFace(b, b, x, y, z, idx)
+		}
 	}
 }
 
-func (v *View) Render() error {
-	mvp := gl.GetUniformLocation(v.voxelProgramID, "u_mvp")
-
-	m := v.mvpMatrix
-	gl.UniformMatrix4fv(mvp, m.Slice())
-
-	m = v.viewMatrix
-	m.MultMatrix(&v.modelMatrix)
-
-	//m.Invert()
-	//m.Transpose()
-
-	mv := gl.GetUniformLocation(v.voxelProgramID, "u_mv")
-	gl.UniformMatrix4fv(mv, m.Slice())
-
-	for _, b := range v.buffers {
-		gl.Uniform3fv(v.normalUniform, b.normal.Slice())
-		b.draw(v.positionAttrib)
+// appendFace adds the face of voxel x,y,z facing the same direction as face
+// to dst, if it is exposed.
+func (v *View) appendFace(dst, face *faceBuffer, x, y, z, idx int) {
+	if v.isFaceExposed(x, y, z, face.normal) {
+		var ao [8]byte
+		v.faceAO(x, y, z, face.normal, &ao)
+		pal := v.paletteMap[v.paletteRows[idx]]
+		dst.append(face.face, byte(x), byte(y), byte(z), 1, v.data[idx], pal, &ao)
 	}
-	return nil
 }
 
-var vertexShaderSrc = `
-	#version 120
+// isFaceExposed reports if the face of voxel x,y,z with normal n is visible.
+// Faces between two translucent voxels are hidden so the inside of water and
+// glass is not drawn.
+func (v *View) isFaceExposed(x, y, z int, n vec3.T) bool {
+	nx, ny, nz := x+int(n[0]), y+int(n[1]), z+int(n[2])
+	if nx < 0 || ny < 0 || nz < 0 || nx >= SizeX || ny >= SizeY || nz >= SizeZ {
+		return true
+	}
 
-	uniform mat4 u_mvp;
-	uniform mat4 u_mv;
-	uniform vec3 u_normal;
+	idx := offset(nx, ny, nz)
+	if v.data[idx] == 0 {
+		return true
+	}
+	return v.isTranslucent(idx) && !v.isTranslucent(offset(x, y, z))
+}
 
-	attribute vec4 a_position;
+// isSolid reports if voxel x,y,z is opaque, only opaque voxels occlude.
+func (v *View) isSolid(x, y, z int) bool {
+	if x < 0 || y < 0 || z < 0 || x >= SizeX || y >= SizeY || z >= SizeZ {
+		return false
+	}
 
-	varying float v_color_index;
-	varying vec3 v_light;
+	idx := offset(x, y, z)
+	return v.data[idx] != 0 && !v.isTranslucent(idx)
+}
 
-	void main()
-	{
-		v_color_index = a_position.w / 255;
+// faceAO calculates the ambient occlusion of the vertices on the face of
+// voxel x,y,z with normal n. The result is indexed by cube vertex.
+func (v *View) faceAO(x, y, z int, n vec3.T, ao *[8]byte) {
+	// The layer of voxels in front of the face.
+	fx, fy, fz := x+int(n[0]), y+int(n[1]), z+int(n[2])
+
+	for i := 0; i < 8; i++ {
+		var d [3]int
+		for j := range d {
+			if n[j] == 0 {
+				d[j] = int(cubeVertices[i*3+j])*2 - 1
+			}
+		}
 
-		// Lighting
+		var side1, side2 bool
+		switch {
+		case n[0] != 0:
+			side1 = v.isSolid(fx, fy+d[1], fz)
+			side2 = v.isSolid(fx, fy, fz+d[2])
+		case n[1] != 0:
+			side1 = v.isSolid(fx+d[0], fy, fz)
+			side2 = v.isSolid(fx, fy, fz+d[2])
+		default:
+			side1 = v.isSolid(fx+d[0], fy, fz)
+			side2 = v.isSolid(fx, fy+d[1], fz)
+		}
 
-		const vec3 lightColor = vec3(1,1,1);
-		vec3 lightDir = normalize(vec3(-1,1,-1));
+		if side1 && side2 {
+			ao[i] = 0
+			continue
+		}
 
-		const float ambientStrength = 0.8;
-		vec3 ambient = ambientStrength * lightColor;
+		occlusion := byte(3)
+		if side1 {
+			occlusion--
+		}
+		if side2 {
+			occlusion--
+		}
+		if v.isSolid(fx+d[0], fy+d[1], fz+d[2]) {
+			occlusion--
+		}
+		ao[i] = occlusion
+	}
+}
 
-		//vec3 normal = normalize(mat3(u_mv) * u_normal);
-		vec3 normal = u_normal;
+func (v *View) Clear(c byte) {
+	for z := 0; z < SizeZ; z++ {
+		for y := 0; y < SizeY; y++ {
+			for x := 0; x < SizeX; x++ {
+				idx := offset(x, y, z)
+				v.data[idx] = c
+				v.paletteRows[idx] = 0
+			}
+		}
+	}
+}
 
-		float diff = max(dot(normal, lightDir), 0);
-		vec3 diffuse = diff * lightColor;
+func (v *View) Render() error {
+	return v.renderer.render(v)
+}
 
-		v_light = ambient + diffuse;
-		gl_Position = u_mvp * vec4(a_position.xyz, 1);
+// eyeSpaceLights returns the directional light direction and the point light
+// positions transformed to eye space, mv is the model view matrix.
+func (v *View) eyeSpaceLights(mv *mat4.T) (vec3.T, [maxPointLights]vec3.T) {
+	var pos [maxPointLights]vec3.T
+	for i := range v.pointLights {
+		pos[i] = transformVec3(mv, &v.pointLights[i].Position, 1)
 	}
-`
-
-var fragmentShaderSrc = `
-	#version 120
 
-	uniform sampler2D u_palettes;
+	dir := transformVec3(&v.viewMatrix, &v.sun.Direction, 0)
+	dir.Normalize()
+	return dir, pos
+}
 
-	varying float v_color_index;
-	varying vec3 v_light;
+// cameraPosition returns the camera position in model space. The model view
+// matrix is rigid so the position is -R^T * t.
+func cameraPosition(mv *mat4.T) vec3.T {
+	a := mv.Array()
+	var pos vec3.T
+	for i := range pos {
+		pos[i] = -(a[i*4]*a[12] + a[i*4+1]*a[13] + a[i*4+2]*a[14])
+	}
+	return pos
+}
 
-	void main()
-	{
-		vec3 voxel_color = texture2D(u_palettes, vec2(v_color_index, 0)).xyz;
-		gl_FragColor = vec4(voxel_color * v_light, 1);
+// transformVec3 multiplies m with the vector (p, w).
+func transformVec3(m *mat4.T, p *vec3.T, w float32) vec3.T {
+	a := m.Array()
+	return vec3.T{
+		a[0]*p[0] + a[4]*p[1] + a[8]*p[2] + a[12]*w,
+		a[1]*p[0] + a[5]*p[1] + a[9]*p[2] + a[13]*w,
+		a[2]*p[0] + a[6]*p[1] + a[10]*p[2] + a[14]*w,
 	}
-`
+}
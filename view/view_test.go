@@ -0,0 +1,150 @@
+// +------------------=V=o=x=B=o=x=-=E=n=g=i=n=e=--------------------+
+// | Copyright (C) 2016-2017 Andreas T Jonsson. All rights reserved. |
+// | Contact <mail@andreasjonsson.se>                                |
+// +-----------------------------------------------------------------+
+
+package view
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ungerik/go3d/mat4"
+	"github.com/ungerik/go3d/vec3"
+)
+
+var update = flag.Bool("update", false, "update the golden images in testdata")
+
+// Triangle edges are rasterized slightly differently on architectures that
+// fuse multiply-adds. Channels within channelTolerance of the golden image
+// match, and up to maxDiffPixels pixels may differ more than that.
+const (
+	channelTolerance = 8
+	maxDiffPixels    = 32
+)
+
+// testScene fills v with a floor, a pillar and a translucent block around
+// the center of the view.
+func testScene(v *View) {
+	v.SetPalettes(color.Palette{
+		color.RGBA{},
+		color.RGBA{90, 160, 70, 255},
+		color.RGBA{200, 80, 60, 255},
+		color.RGBA{80, 120, 220, 255},
+	})
+	v.SetMaterial(0, 3, Material{Transparency: 0.5})
+
+	const c = SizeX / 2
+	for z := c - 8; z < c+8; z++ {
+		for x := c - 8; x < c+8; x++ {
+			v.Set(x, 0, z, 1)
+		}
+	}
+	for y := 1; y < 8; y++ {
+		v.Set(c-2, y, c-2, 2)
+		v.Set(c-1, y, c-2, 2)
+	}
+	for z := c + 2; z < c+4; z++ {
+		for x := c + 2; x < c+4; x++ {
+			v.Set(x, 1, z, 3)
+		}
+	}
+}
+
+func TestSoftwareRenderer(t *testing.T) {
+	const width, height = 160, 120
+
+	r := NewSoftwareRenderer(width, height)
+	v, err := NewView(ConfigWithRenderer(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Destroy()
+
+	testScene(v)
+
+	var proj, viewMatrix mat4.T
+	proj.AssignPerspectiveProjection(-0.08, 0.08, -0.06, 0.06, 0.1, 100)
+	eye, center, up := vec3.T{9, 8, 12}, vec3.T{0, 2, 0}, vec3.T{0, 1, 0}
+	lookAt(&viewMatrix, &eye, &center, &up)
+
+	v.BuildBuffers(&proj, &viewMatrix)
+	if err := v.Render(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join("testdata", "software.png")
+	if *update {
+		if err := writePNG(file, r.Image()); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	golden, err := readPNG(file)
+	if err != nil {
+		t.Fatalf("%v, run with -update to create it", err)
+	}
+	if diff := countDiff(golden, r.Image()); diff > maxDiffPixels {
+		t.Errorf("%d pixels differ from %s, run with -update if the change is intended", diff, file)
+	}
+}
+
+// countDiff returns the number of pixels with a channel that differs more
+// than channelTolerance between a and b.
+func countDiff(a image.Image, b *image.RGBA) int {
+	if a.Bounds() != b.Bounds() {
+		return b.Bounds().Dx() * b.Bounds().Dy()
+	}
+
+	n := 0
+	bounds := b.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			ca := color.RGBAModel.Convert(a.At(x, y)).(color.RGBA)
+			cb := b.RGBAAt(x, y)
+			if channelDiff(ca.R, cb.R) > channelTolerance || channelDiff(ca.G, cb.G) > channelTolerance ||
+				channelDiff(ca.B, cb.B) > channelTolerance || channelDiff(ca.A, cb.A) > channelTolerance {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func channelDiff(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+func readPNG(file string) (image.Image, error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+	return png.Decode(fp)
+}
+
+func writePNG(file string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	fp, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(fp, img); err != nil {
+		fp.Close()
+		return err
+	}
+	return fp.Close()
+}